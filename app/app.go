@@ -2,10 +2,12 @@ package app
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/daemtri/begonia/app/config"
 	"github.com/daemtri/begonia/app/pubsub"
 	"github.com/daemtri/begonia/app/resources"
+	"github.com/daemtri/begonia/app/schedule"
 	"github.com/daemtri/begonia/bootstrap"
 	"github.com/daemtri/begonia/contract"
 	"github.com/daemtri/begonia/di/box"
@@ -17,6 +19,7 @@ import (
 	"github.com/daemtri/begonia/runtime"
 	"github.com/daemtri/begonia/runtime/component"
 
+	_ "github.com/daemtri/begonia/runtime/contrib/etcd"
 	"github.com/daemtri/begonia/runtime/contrib/files"
 	_ "github.com/daemtri/begonia/runtime/contrib/k8s"
 	_ "github.com/daemtri/begonia/runtime/contrib/nacos"
@@ -31,14 +34,33 @@ var (
 	enableSideCarMode bool
 	logger            = logx.GetLogger("app")
 	remoteConfigName  string
+	drainPeriod       time.Duration
+
+	routeInterceptors []contract.RouteInterceptor
 )
 
+// UseRouteInterceptor 添加全局路由拦截器，作用于所有模块注册的路由，必须在Run之前调用
+func UseRouteInterceptor(interceptors ...contract.RouteInterceptor) {
+	routeInterceptors = append(routeInterceptors, interceptors...)
+}
+
+func newRouteRegistrar() (*bootstrap.RouteRegistrar, error) {
+	rr, err := bootstrap.NewRouteRegistrar()
+	if err != nil {
+		return nil, err
+	}
+	rr.Use(routeInterceptors...)
+	return rr, nil
+}
+
 func Run(name string) {
 	runtime.SetServiceName(name)
 
 	box.FlagSet().StringVar(&broadCastHost, "broadcast-host", broadCastHost, "默认广播地址")
 	box.FlagSet().BoolVar(&enableSideCarMode, "sidecar-enable", false, "开启sgr服务发现边车模式")
 	box.FlagSet().StringVar(&remoteConfigName, "remote-config", "", "远程配置文件路径")
+	box.FlagSet().DurationVar(&drainPeriod, "drain-period", 5*time.Second, "退出时注销服务后等待流量排空的时间")
+	box.FlagSet().DurationVar(&electionTTL, "election-ttl", electionTTL, "领导选举会话过期时间")
 
 	// 注册基础功能
 	box.Provide[*grpcx.ClientBuilder](grpcx.NewClientBuilder, box.WithFlags("grpc-client"))
@@ -52,14 +74,20 @@ func Run(name string) {
 
 	// 注册runtime
 	box.Provide[component.Configurator](&runtime.Builder[component.Configurator]{Name: files.Name}, box.WithFlags("config"))
-	box.Provide[component.Discovery](&runtime.Builder[component.Discovery]{Name: configDiscoveryName}, box.WithFlags("discovery"))
+	box.Provide[component.Discovery](&discoveryBuilder{Builder: runtime.Builder[component.Discovery]{Name: configDiscoveryName}}, box.WithFlags("discovery"))
 	box.Provide[component.DistrubutedLocker](&runtime.Builder[component.DistrubutedLocker]{Name: redis.Name}, box.WithFlags("lock"))
+	box.Provide[component.Concurrency](&runtime.Builder[component.Concurrency]{Name: redis.Name}, box.WithFlags("concurrency"))
 
 	// 注册bootstrap
-	box.Provide[*bootstrap.RouteRegistrar](bootstrap.NewRouteRegistrar)
+	box.Provide[*bootstrap.RouteRegistrar](newRouteRegistrar)
 	box.Provide[*bootstrap.ServiceRegistrar](bootstrap.NewServiceRegistrar)
 	box.Provide[*bootstrap.ContextInjector](bootstrap.NewContextInjector)
 	box.Provide[*bootstrap.BusinessService](bootstrap.NewBusinessService)
+	box.Provide[*bootstrap.HealthChecker](bootstrap.NewHealthChecker, box.WithFlags("health"))
+	box.Provide[bootstrap.Runable](func(hc *bootstrap.HealthChecker) bootstrap.Runable { return hc }, box.WithName("health"))
+	box.Provide[bootstrap.Runable](newDebugServer, box.WithFlags("debug-server"), box.WithName("debug"))
+	box.Provide[bootstrap.Runable](newDiscoveryAgentStopper, box.WithName("discovery"))
+	box.Provide[bootstrap.Runable](newTracerProviderStopper, box.WithName("tracing"))
 	box.Provide[bootstrap.Server](bootstrap.NewLogicServer, box.WithFlags("grpc-server"), box.WithName("grpc"))
 	box.Provide[bootstrap.Server](bootstrap.NewHttpServer, box.WithFlags("http-server"), box.WithName("http"))
 	box.Provide[bootstrap.Runable](func(server bootstrap.Server) bootstrap.Runable { return server },
@@ -74,8 +102,14 @@ func Run(name string) {
 	box.Provide[GrpcServiceRegistrar](newGrpcServiceRegistrarImpl)
 	box.Provide[*kafka.Producer](kafka.NewProducer, box.WithFlags("kafka-producer"))
 	box.Provide[pubsub.Publisher](pubsub.NewKafkaPublisher)
-	box.Provide[contract.PubSubConsumerRegistrar](&mockPubSubConsumerRegistrar{})
-	box.Provide[contract.TaskProcessorRegistrar](&mockTaskProcessorRegistrar{})
+	box.Provide[*kafka.Consumer](newKafkaConsumer, box.WithFlags("kafka-consumer"))
+	box.Provide[pubsub.Subscriber](pubsub.NewKafkaSubscriber)
+	box.Provide[*pubSubConsumerRegistrar](newPubSubConsumerRegistrar, box.WithFlags("pubsub-consumer"))
+	box.Provide[contract.PubSubConsumerRegistrar](func(r *pubSubConsumerRegistrar) contract.PubSubConsumerRegistrar { return r })
+	box.Provide[bootstrap.Runable](func(r *pubSubConsumerRegistrar) bootstrap.Runable { return r }, box.WithName("pubsub"))
+	box.Provide[*schedule.Processor](newTaskProcessor, box.WithFlags("schedule"))
+	box.Provide[contract.TaskProcessorRegistrar](newTaskProcessorRegistrar)
+	box.Provide[bootstrap.Runable](func(p *schedule.Processor) bootstrap.Runable { return p }, box.WithName("schedule"))
 	box.Provide[*resources.Manager](resources.NewManager, box.WithFlags("resources"))
 	box.Provide[chi.Router](newHttpServerMux)
 	box.Provide[http.Handler](func(r chi.Router) http.Handler { return r })
@@ -84,6 +118,8 @@ func Run(name string) {
 
 	// 初始化module和服务注册
 	box.UseInit(initModules())
+	// 没有本地父span的http请求和kafka消息通过全局TracerProvider导出
+	box.UseInit(setGlobalTracerProvider)
 
 	if err := box.Bootstrap[bootstrap.Engine](
 		yamlconfig.Init(),
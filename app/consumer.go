@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/app/pubsub"
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/driver/kafka"
+	"github.com/daemtri/begonia/runtime"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ctxType          = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errType          = reflect.TypeOf((*error)(nil)).Elem()
+	protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+	// errInvalidMessage 消息无法解析，重试也无法成功，直接跳过
+	errInvalidMessage = errors.New("invalid message")
+)
+
+type consumerOption struct {
+	Concurrency  int           `flag:"concurrency" default:"1" usage:"每个topic默认的消费者数量"`
+	MinBackoff   time.Duration `flag:"min_backoff" default:"100ms" usage:"消息处理失败后重试的最小退避时间"`
+	MaxBackoff   time.Duration `flag:"max_backoff" default:"10s" usage:"消息处理失败后重试的最大退避时间"`
+	DrainTimeout time.Duration `flag:"drain_timeout" default:"10s" usage:"退出时等待处理中消息完成的最长时间"`
+	MaxRetry     int           `flag:"max_retry" default:"10" usage:"消息处理失败的最大重试次数,超过后消息转发到死信topic,0表示一直重试"`
+	DeadLetter   string        `flag:"dead_letter" default:"{topic}.dlq" usage:"死信topic,{topic}替换为原topic,为空时丢弃超过最大重试次数的消息"`
+}
+
+// newKafkaConsumer 没有配置消费组时使用服务名作为消费组
+func newKafkaConsumer(opt *kafka.ConsumerOption) (*kafka.Consumer, error) {
+	if opt.Group == "" {
+		opt.Group = runtime.GetServiceName()
+	}
+	return kafka.NewConsumer(opt)
+}
+
+type subscription struct {
+	topic       string
+	module      *moduleRuntime
+	concurrency int
+	handle      func(ctx context.Context, msg pubsub.Message) error
+}
+
+// pubSubConsumerRegistrar 实现contract.PubSubConsumerRegistrar
+// 每个订阅会启动concurrency个属于同一消费组的消费者，消息处理成功后才会提交
+type pubSubConsumerRegistrar struct {
+	opts          *consumerOption
+	subscriber    pubsub.Subscriber
+	publisher     pubsub.Publisher
+	subscriptions []*subscription
+}
+
+func newPubSubConsumerRegistrar(opts *consumerOption, subscriber pubsub.Subscriber, publisher pubsub.Publisher) (*pubSubConsumerRegistrar, error) {
+	return &pubSubConsumerRegistrar{
+		opts:       opts,
+		subscriber: subscriber,
+		publisher:  publisher,
+	}, nil
+}
+
+func (r *pubSubConsumerRegistrar) SubscribeTopic(topic string, handle any, opts ...contract.SubscribeOption) {
+	so := contract.SubscribeOptions{Concurrency: r.opts.Concurrency}
+	for i := range opts {
+		opts[i](&so)
+	}
+	r.subscriptions = append(r.subscriptions, &subscription{
+		topic:       topic,
+		module:      currentModule,
+		concurrency: max(so.Concurrency, 1),
+		handle:      parseSubscribeHandle(topic, handle),
+	})
+}
+
+// parseSubscribeHandle 将 func(context.Context, T) error 转换为统一的消息处理函数
+func parseSubscribeHandle(topic string, handle any) func(ctx context.Context, msg pubsub.Message) error {
+	switch h := handle.(type) {
+	case func(context.Context, pubsub.Message) error:
+		return h
+	case func(context.Context, []byte) error:
+		return func(ctx context.Context, msg pubsub.Message) error {
+			return h(ctx, msg.Value())
+		}
+	}
+	fn := reflect.ValueOf(handle)
+	typ := fn.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() != 2 || typ.NumOut() != 1 ||
+		typ.In(0) != ctxType || typ.Out(0) != errType ||
+		typ.In(1).Kind() != reflect.Pointer || !typ.In(1).Implements(protoMessageType) {
+		panic(fmt.Errorf("topic %s handle must be func(context.Context, T) error, T is pubsub.Message, []byte or proto.Message, got %T", topic, handle))
+	}
+	msgType := typ.In(1).Elem()
+	return func(ctx context.Context, msg pubsub.Message) error {
+		v := reflect.New(msgType)
+		if err := proto.Unmarshal(msg.Value(), v.Interface().(proto.Message)); err != nil {
+			return fmt.Errorf("%w: topic %s does not match the message type %s, error %s", errInvalidMessage, topic, msgType, err)
+		}
+		if ret := fn.Call([]reflect.Value{reflect.ValueOf(ctx), v})[0].Interface(); ret != nil {
+			return ret.(error)
+		}
+		return nil
+	}
+}
+
+func (r *pubSubConsumerRegistrar) Enabled() bool {
+	return len(r.subscriptions) > 0
+}
+
+func (r *pubSubConsumerRegistrar) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, sub := range r.subscriptions {
+		for i := 0; i < sub.concurrency; i++ {
+			reader := r.subscriber.Subscribe(ctx, sub.topic)
+			wg.Add(1)
+			go func(sub *subscription) {
+				defer wg.Done()
+				defer reader.Close()
+				r.consume(ctx, sub, reader)
+			}(sub)
+		}
+		logger.Info("topic subscribed", "topic", sub.topic, "module", sub.module.moduleName, "concurrency", sub.concurrency)
+	}
+	<-ctx.Done()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(r.opts.DrainTimeout):
+		logger.Warn("pubsub consumers drain timeout", "timeout", r.opts.DrainTimeout)
+	}
+	return nil
+}
+
+func (r *pubSubConsumerRegistrar) consume(ctx context.Context, sub *subscription, reader pubsub.MessageReader) {
+	// 消息处理不跟随ctx取消,保证退出时处理中的消息可以完成并提交
+	handleCtx := withObjectContainer(context.WithoutCancel(ctx), sub.module)
+	for {
+		msg, err := reader.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("fetch message error", "topic", sub.topic, "error", err)
+			if !sleepContext(ctx, r.opts.MinBackoff) {
+				return
+			}
+			continue
+		}
+		msgCtx, span := startConsumeSpan(handleCtx, sub, msg)
+		ok := r.handle(ctx, msgCtx, sub, msg)
+		span.End()
+		if !ok {
+			return
+		}
+		commitCtx, cancel := context.WithTimeout(handleCtx, 5*time.Second)
+		if err := reader.Commit(commitCtx, msg); err != nil {
+			logger.Warn("commit message error", "topic", sub.topic, "error", err)
+		}
+		cancel()
+	}
+}
+
+// handle 处理消息直到成功或者转发到死信topic，返回false表示ctx已取消，消息不应该被提交
+func (r *pubSubConsumerRegistrar) handle(ctx, handleCtx context.Context, sub *subscription, msg pubsub.Message) bool {
+	backoff := r.opts.MinBackoff
+	for retried := 0; ; retried++ {
+		err := safeHandle(handleCtx, sub, msg)
+		if err == nil {
+			return true
+		}
+		trace.SpanFromContext(handleCtx).RecordError(err)
+		if errors.Is(err, errInvalidMessage) || (r.opts.MaxRetry > 0 && retried >= r.opts.MaxRetry) {
+			return r.deadLetter(ctx, handleCtx, sub, msg, err)
+		}
+		logger.Warn("handle message error, retry later", "topic", sub.topic, "retried", retried, "backoff", backoff, "error", err)
+		if !sleepContext(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, r.opts.MaxBackoff)
+	}
+}
+
+// deadLetter 将无法处理的消息转发到死信topic，转发成功后消息才会被提交
+func (r *pubSubConsumerRegistrar) deadLetter(ctx, handleCtx context.Context, sub *subscription, msg pubsub.Message, cause error) bool {
+	if r.opts.DeadLetter == "" {
+		logger.Error("drop message", "topic", sub.topic, "error", cause)
+		return true
+	}
+	dlq := &deadLetterMessage{
+		topic: strings.ReplaceAll(r.opts.DeadLetter, "{topic}", sub.topic),
+		value: msg.Value(),
+	}
+	backoff := r.opts.MinBackoff
+	for {
+		err := r.publisher.Publish(handleCtx, dlq)
+		if err == nil {
+			logger.Error("message moved to dead letter topic", "topic", sub.topic, "dead_letter", dlq.topic, "error", cause)
+			return true
+		}
+		logger.Warn("publish dead letter error, retry later", "topic", sub.topic, "dead_letter", dlq.topic, "backoff", backoff, "error", err)
+		if !sleepContext(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, r.opts.MaxBackoff)
+	}
+}
+
+type deadLetterMessage struct {
+	topic string
+	value []byte
+}
+
+func (m *deadLetterMessage) Topic() string { return m.topic }
+func (m *deadLetterMessage) Value() []byte { return m.value }
+
+func safeHandle(ctx context.Context, sub *subscription, msg pubsub.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("message handle panic: %v", r)
+		}
+	}()
+	return sub.handle(ctx, msg)
+}
+
+func (r *pubSubConsumerRegistrar) GracefulStop() {}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
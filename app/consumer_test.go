@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/app/pubsub"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testMessage struct {
+	topic string
+	value []byte
+}
+
+func (m *testMessage) Topic() string { return m.topic }
+func (m *testMessage) Value() []byte { return m.value }
+
+type testReader struct {
+	msgs      chan pubsub.Message
+	committed chan pubsub.Message
+}
+
+func (r *testReader) Next() (pubsub.Message, error) { return r.Fetch(context.Background()) }
+
+func (r *testReader) Fetch(ctx context.Context) (pubsub.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *testReader) Commit(ctx context.Context, msg pubsub.Message) error {
+	r.committed <- msg
+	return nil
+}
+
+func (r *testReader) Close() error { return nil }
+
+type testSubscriber struct {
+	mux    sync.Mutex
+	topics []string
+	reader *testReader
+}
+
+func (s *testSubscriber) Subscribe(ctx context.Context, topic ...string) pubsub.MessageReader {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.topics = append(s.topics, topic...)
+	return s.reader
+}
+
+type testPublisher struct {
+	published chan pubsub.Message
+}
+
+func (p *testPublisher) Publish(ctx context.Context, msg pubsub.Message) error {
+	p.published <- msg
+	return nil
+}
+
+func newTestConsumerRegistrar(maxRetry int) (*pubSubConsumerRegistrar, *testSubscriber, *testPublisher) {
+	sub := &testSubscriber{reader: &testReader{
+		msgs:      make(chan pubsub.Message, 1),
+		committed: make(chan pubsub.Message, 1),
+	}}
+	pub := &testPublisher{published: make(chan pubsub.Message, 1)}
+	r, _ := newPubSubConsumerRegistrar(&consumerOption{
+		Concurrency:  1,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		DrainTimeout: time.Second,
+		MaxRetry:     maxRetry,
+		DeadLetter:   "{topic}.dlq",
+	}, sub, pub)
+	return r, sub, pub
+}
+
+// subscribeTopic 模拟模块在Init中订阅topic
+func subscribeTopic(r *pubSubConsumerRegistrar, mr *moduleRuntime, topic string, handle any) {
+	currentModule = mr
+	defer func() { currentModule = nil }()
+	r.SubscribeTopic(topic, handle)
+}
+
+func runRegistrar(t *testing.T, r *pubSubConsumerRegistrar) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitMessage(t *testing.T, ch <-chan pubsub.Message) pubsub.Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func TestConsumerCommitAfterHandle(t *testing.T) {
+	r, sub, _ := newTestConsumerRegistrar(0)
+	mr := &moduleRuntime{moduleName: "order"}
+	var handled *moduleRuntime
+	subscribeTopic(r, mr, "orders", func(ctx context.Context, msg pubsub.Message) error {
+		handled = objectContainerFromCtx(ctx).moduleRuntime
+		return nil
+	})
+	if !r.Enabled() {
+		t.Fatal("registrar should be enabled")
+	}
+	runRegistrar(t, r)
+
+	sub.reader.msgs <- &testMessage{topic: "orders", value: []byte("1")}
+	msg := waitMessage(t, sub.reader.committed)
+	if string(msg.Value()) != "1" {
+		t.Errorf("unexpected committed message %s", msg.Value())
+	}
+	if handled != mr {
+		t.Error("handler context does not contain the module object container")
+	}
+	if len(sub.topics) != 1 || sub.topics[0] != "orders" {
+		t.Errorf("unexpected subscribed topics %v", sub.topics)
+	}
+}
+
+func TestConsumerRetry(t *testing.T) {
+	r, sub, pub := newTestConsumerRegistrar(5)
+	calls := 0
+	subscribeTopic(r, &moduleRuntime{moduleName: "order"}, "orders", func(ctx context.Context, value []byte) error {
+		calls++
+		if calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	runRegistrar(t, r)
+
+	sub.reader.msgs <- &testMessage{topic: "orders", value: []byte("1")}
+	waitMessage(t, sub.reader.committed)
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+	select {
+	case msg := <-pub.published:
+		t.Errorf("unexpected dead letter %s", msg.Topic())
+	default:
+	}
+}
+
+func TestConsumerDeadLetter(t *testing.T) {
+	r, sub, pub := newTestConsumerRegistrar(2)
+	calls := 0
+	subscribeTopic(r, &moduleRuntime{moduleName: "order"}, "orders", func(ctx context.Context, msg *wrapperspb.StringValue) error {
+		calls++
+		return errors.New("failed")
+	})
+	runRegistrar(t, r)
+
+	value, _ := proto.Marshal(wrapperspb.String("hello"))
+	sub.reader.msgs <- &testMessage{topic: "orders", value: value}
+	dlq := waitMessage(t, pub.published)
+	if dlq.Topic() != "orders.dlq" || string(dlq.Value()) != string(value) {
+		t.Errorf("unexpected dead letter %s %s", dlq.Topic(), dlq.Value())
+	}
+	waitMessage(t, sub.reader.committed)
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	// 无法解析的消息不重试，直接转发到死信topic
+	sub.reader.msgs <- &testMessage{topic: "orders", value: []byte{0xff}}
+	waitMessage(t, pub.published)
+	waitMessage(t, sub.reader.committed)
+	if calls != 3 {
+		t.Errorf("invalid message should not be handled, calls %d", calls)
+	}
+}
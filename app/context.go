@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"sync"
 
 	"github.com/daemtri/begonia/app/depency"
 	"github.com/daemtri/begonia/pkg/helper"
@@ -41,6 +42,23 @@ type moduleRuntime struct {
 	opts       *moduleOption
 	module     Module
 	config     helper.OnceCell[any]
+
+	campaignsMux sync.Mutex
+	campaigns    []*campaign
+}
+
+func (mr *moduleRuntime) addCampaign(c *campaign) {
+	mr.campaignsMux.Lock()
+	defer mr.campaignsMux.Unlock()
+	mr.campaigns = append(mr.campaigns, c)
+}
+
+func (mr *moduleRuntime) takeCampaigns() []*campaign {
+	mr.campaignsMux.Lock()
+	defer mr.campaignsMux.Unlock()
+	campaigns := mr.campaigns
+	mr.campaigns = nil
+	return campaigns
 }
 
 func (mr *moduleRuntime) init() error {
@@ -8,7 +8,10 @@ import (
 
 	"context"
 
+	"github.com/daemtri/begonia/bootstrap"
 	"github.com/daemtri/begonia/di/box/validate"
+	"github.com/daemtri/begonia/runtime"
+	"github.com/daemtri/begonia/runtime/agent"
 	"github.com/daemtri/begonia/runtime/component"
 )
 
@@ -20,6 +23,61 @@ func init() {
 	component.Register[component.Discovery](configDiscoveryName, &DiscoveryBootloader{})
 }
 
+// discoveryBuilder 构建服务发现驱动，并使用agent.DiscoveryAgent包装
+// 同一个服务只watch一次，grpc resolver和Browse都从缓存读取
+type discoveryBuilder struct {
+	runtime.Builder[component.Discovery] `flag:""`
+	Agent                                agent.Options `flag:"agent"`
+}
+
+func (b *discoveryBuilder) Build(ctx context.Context) (component.Discovery, error) {
+	if err := b.Agent.ValidateFlags(); err != nil {
+		return nil, err
+	}
+	d, err := b.Builder.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return agent.NewDiscoveryAgent(d, b.Agent), nil
+}
+
+// newDebugServer 通过debug server访问 /debug/discovery 查看缓存的服务
+func newDebugServer(opt *bootstrap.DebugServerRunOption, hc *bootstrap.HealthChecker, d component.Discovery) (bootstrap.Runable, error) {
+	s, err := bootstrap.NewDebugServer(opt, hc)
+	if err != nil {
+		return nil, err
+	}
+	if da, ok := d.(*agent.DiscoveryAgent); ok {
+		s.Handle("/debug/discovery", da)
+	}
+	return s, nil
+}
+
+// discoveryAgentStopper engine退出后关闭DiscoveryAgent，停止所有服务的watch
+type discoveryAgentStopper struct {
+	da *agent.DiscoveryAgent
+}
+
+func newDiscoveryAgentStopper(d component.Discovery) bootstrap.Runable {
+	da, _ := d.(*agent.DiscoveryAgent)
+	return &discoveryAgentStopper{da: da}
+}
+
+func (s *discoveryAgentStopper) Enabled() bool {
+	return s.da != nil
+}
+
+func (s *discoveryAgentStopper) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *discoveryAgentStopper) GracefulStop() {}
+
+func (s *discoveryAgentStopper) PostStop(_ context.Context) {
+	s.da.Close()
+}
+
 type DiscoveryBootloader struct {
 	reg Registry
 }
@@ -64,6 +122,11 @@ func (r *Registry) Register(ctx context.Context, service component.ServiceEntry)
 	return nil
 }
 
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	r.logger.Info("deregister", "service", service)
+	return nil
+}
+
 func (r *Registry) Lookup(ctx context.Context, name, id string) (se *component.ServiceEntry, err error) {
 	service, err := r.Browse(ctx, name)
 	if err != nil {
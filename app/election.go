@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/runtime"
+)
+
+var electionTTL = 10 * time.Second
+
+// Campaign 参与名为name的领导选举，同一服务的所有实例中同时只有一个实例会被选为leader
+// 会话过期(如续约失败)时会取消OnElected的ctx并调用OnRevoked，之后重新参与选举
+// ctx取消、调用Resign或者模块Destroy后退出选举
+func Campaign(ctx context.Context, name string, callbacks contract.LeaderCallbacks) contract.Leadership {
+	mr := objectContainerFromCtx(ctx).moduleRuntime
+	ctx, cancel := context.WithCancel(ctx)
+	c := &campaign{
+		name:      path.Join("election", runtime.GetServiceName(), name),
+		callbacks: callbacks,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	mr.addCampaign(c)
+	go c.run(ctx)
+	return c
+}
+
+type campaign struct {
+	name      string
+	callbacks contract.LeaderCallbacks
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	leader atomic.Bool
+	fence  atomic.Int64
+}
+
+func (c *campaign) IsLeader() bool {
+	return c.leader.Load()
+}
+
+func (c *campaign) Fence() int64 {
+	return c.fence.Load()
+}
+
+func (c *campaign) Resign(ctx context.Context) error {
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *campaign) run(ctx context.Context) {
+	defer close(c.done)
+	backoff := time.Second
+	for ctx.Err() == nil {
+		if err := c.campaign(ctx); err != nil {
+			logger.Warn("campaign error", "name", c.name, "backoff", backoff, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, electionTTL)
+			continue
+		}
+		backoff = time.Second
+	}
+}
+
+// campaign 完成一轮选举：等待成为leader，直到失去leader
+func (c *campaign) campaign(ctx context.Context) error {
+	session, err := concurrency.NewSession(ctx, electionTTL)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	mu := session.NewMutex(c.name)
+	if err := mu.Lock(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	fence := mu.Fence()
+	c.fence.Store(fence)
+	c.leader.Store(true)
+	logger.Info("elected as leader", "name", c.name, "fence", fence)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if c.callbacks.OnElected != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.callbacks.OnElected(leaderCtx, fence)
+		}()
+	}
+	select {
+	case <-ctx.Done():
+	case <-session.Done():
+		logger.Warn("leader session expired", "name", c.name)
+	}
+	cancel()
+	wg.Wait()
+
+	c.leader.Store(false)
+	unlockCtx, cancelUnlock := context.WithTimeout(context.WithoutCancel(ctx), electionTTL)
+	defer cancelUnlock()
+	if err := mu.Unlock(unlockCtx); err != nil {
+		logger.Debug("unlock leader mutex error", "name", c.name, "error", err)
+	}
+	logger.Info("leadership revoked", "name", c.name)
+	if c.callbacks.OnRevoked != nil {
+		c.callbacks.OnRevoked(unlockCtx)
+	}
+	return nil
+}
+
+// resignAll 模块Destroy时放弃所有选举
+func resignAll(ctx context.Context, campaigns []*campaign) {
+	for _, c := range campaigns {
+		if err := c.Resign(ctx); err != nil {
+			logger.Warn("resign error", "name", c.name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/driver/redis"
+	"github.com/daemtri/begonia/logx"
+	redisconcurrency "github.com/daemtri/begonia/runtime/contrib/redis"
+)
+
+func setupElection(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedis(context.Background(), &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldConcurrency, oldTTL := concurrency, electionTTL
+	concurrency = redisconcurrency.NewConcurrency(client, logx.GetLogger("test"))
+	electionTTL = 300 * time.Millisecond
+	t.Cleanup(func() {
+		concurrency, electionTTL = oldConcurrency, oldTTL
+		client.Close()
+	})
+	return mr
+}
+
+type testCandidate struct {
+	leadership contract.Leadership
+	elected    chan int64
+	revoked    chan struct{}
+}
+
+func newTestCandidate(ctx context.Context, mr *moduleRuntime, name string) *testCandidate {
+	c := &testCandidate{elected: make(chan int64, 1), revoked: make(chan struct{}, 1)}
+	c.leadership = Campaign(withObjectContainer(ctx, mr), name, contract.LeaderCallbacks{
+		OnElected: func(ctx context.Context, fence int64) {
+			c.elected <- fence
+			<-ctx.Done()
+		},
+		OnRevoked: func(ctx context.Context) {
+			c.revoked <- struct{}{}
+		},
+	})
+	return c
+}
+
+func waitSignal[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestCampaign(t *testing.T) {
+	setupElection(t)
+	ctx := context.Background()
+	mr := &moduleRuntime{moduleName: "test"}
+	c1 := newTestCandidate(ctx, mr, "job")
+	fence1 := waitSignal(t, c1.elected, "first leader")
+	if !c1.leadership.IsLeader() || c1.leadership.Fence() != fence1 {
+		t.Fatalf("unexpected leadership %v %d", c1.leadership.IsLeader(), c1.leadership.Fence())
+	}
+
+	c2 := newTestCandidate(ctx, mr, "job")
+	time.Sleep(100 * time.Millisecond)
+	if c2.leadership.IsLeader() {
+		t.Fatal("only one candidate should be leader")
+	}
+
+	if err := c1.leadership.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitSignal(t, c1.revoked, "first revoked")
+	if c1.leadership.IsLeader() {
+		t.Error("resigned candidate should not be leader")
+	}
+	fence2 := waitSignal(t, c2.elected, "second leader")
+	if fence2 <= fence1 {
+		t.Errorf("fence should increase, got %d after %d", fence2, fence1)
+	}
+
+	// 模块Destroy时退出所有选举
+	resignAll(ctx, mr.takeCampaigns())
+	waitSignal(t, c2.revoked, "second revoked")
+	if c2.leadership.IsLeader() {
+		t.Error("candidate should not be leader after resign all")
+	}
+}
+
+func TestCampaignSessionExpired(t *testing.T) {
+	redisServer := setupElection(t)
+	ctx := context.Background()
+	c := newTestCandidate(ctx, &moduleRuntime{moduleName: "test"}, "job")
+	defer c.leadership.Resign(ctx)
+	fence1 := waitSignal(t, c.elected, "leader")
+
+	// 会话过期后取消OnElected的ctx并调用OnRevoked，之后重新参与选举
+	for _, key := range redisServer.Keys() {
+		if strings.HasPrefix(key, "app:session:") {
+			redisServer.Del(key)
+		}
+	}
+	waitSignal(t, c.revoked, "revoked")
+	fence2 := waitSignal(t, c.elected, "re-elected")
+	if fence2 <= fence1 {
+		t.Errorf("fence should increase, got %d after %d", fence2, fence1)
+	}
+}
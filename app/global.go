@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/daemtri/begonia/app/resources"
+	"github.com/daemtri/begonia/app/schedule"
 	"github.com/daemtri/begonia/di/box"
 	"github.com/daemtri/begonia/grpcx"
 	"github.com/daemtri/begonia/pkg/helper"
@@ -16,7 +17,9 @@ var (
 	grpcClientBuilder *grpcx.ClientBuilder
 	configWatcher     component.Configurator
 	distrubutedLocker component.DistrubutedLocker
+	concurrency       component.Concurrency
 	resourcesManager  *resources.Manager
+	taskScheduler     schedule.Scheduler
 )
 
 func initGlobal(ctx context.Context) error {
@@ -24,5 +27,7 @@ func initGlobal(ctx context.Context) error {
 	configWatcher = box.Invoke[component.Configurator](ctx)
 	resourcesManager = box.Invoke[*resources.Manager](ctx)
 	distrubutedLocker = box.Invoke[component.DistrubutedLocker](ctx)
+	concurrency = box.Invoke[component.Concurrency](ctx)
+	taskScheduler = box.Invoke[*schedule.Processor](ctx)
 	return nil
 }
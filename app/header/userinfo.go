@@ -2,9 +2,11 @@ package header
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 
+	"github.com/daemtri/begonia/contract"
 	"github.com/daemtri/begonia/pkg/helper"
 	"google.golang.org/grpc/metadata"
 )
@@ -21,8 +23,58 @@ func GetUserInfoFromIncomingCtx(ctx context.Context) *UserInfo {
 	return &UserInfo{md: md}
 }
 
+// ErrNoUserInfo metadata中没有用户信息
+var ErrNoUserInfo = errors.New("no user info in metadata")
+
+// ParseUserInfoFromIncomingCtx 解析metadata中的用户信息，没有user_id时返回 ErrNoUserInfo，
+// 字段格式错误时返回错误，其他缺少的字段为零值，返回值的getter不会panic
+func ParseUserInfoFromIncomingCtx(ctx context.Context) (contract.UserInfoInterface, error) {
+	md, exists := metadata.FromIncomingContext(ctx)
+	if !exists || len(md.Get("user_id")) == 0 {
+		return nil, ErrNoUserInfo
+	}
+	u := &parsedUserInfo{}
+	for _, f := range []struct {
+		key string
+		val *uint32
+	}{
+		{"user_id", &u.userID},
+		{"tenant_id", &u.tenantID},
+		{"game_id", &u.gameID},
+		{"version", &u.version},
+	} {
+		v := md.Get(f.key)
+		if len(v) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(v[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in metadata: %w", f.key, err)
+		}
+		*f.val = uint32(n)
+	}
+	if v := md.Get("source"); len(v) > 0 {
+		u.source = v[0]
+	}
+	return u, nil
+}
+
+type parsedUserInfo struct {
+	userID   uint32
+	tenantID uint32
+	gameID   uint32
+	version  uint32
+	source   string
+}
+
+func (u *parsedUserInfo) GetUserID() uint32   { return u.userID }
+func (u *parsedUserInfo) GetTenantID() uint32 { return u.tenantID }
+func (u *parsedUserInfo) GetGameID() uint32   { return u.gameID }
+func (u *parsedUserInfo) GetSource() string   { return u.source }
+func (u *parsedUserInfo) GetVersion() uint32  { return u.version }
+
 func (u *UserInfo) get(key string) string {
-	ret := u.md.Get("tenant_id")
+	ret := u.md.Get(key)
 	if len(ret) == 0 {
 		panic(fmt.Errorf("no %s in metadata", key))
 	}
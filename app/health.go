@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+
+	"github.com/daemtri/begonia/contract"
+)
+
+// moduleHealthRegistrar 模块的健康检查名称形如：{module}/{name}
+type moduleHealthRegistrar struct {
+	module string
+	hc     contract.HealthCheckRegistrar
+}
+
+func (r moduleHealthRegistrar) AddCheck(name string, check func(ctx context.Context) error) {
+	r.hc.AddCheck(r.module+"/"+name, check)
+}
+
+// PingDB 返回检查数据库连接的健康检查，用于 Integrator.Health.AddCheck
+func PingDB(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		db, err := resourcesManager.GetDB(ctx, name)
+		if err != nil {
+			return err
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+// PingRedis 返回检查redis连接的健康检查，用于 Integrator.Health.AddCheck
+func PingRedis(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		client, err := resourcesManager.GetRedis(ctx, name)
+		if err != nil {
+			return err
+		}
+		return client.Ping(ctx).Err()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/daemtri/begonia/grpcx/tracing"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/gin-gonic/gin/render"
 )
@@ -37,12 +38,15 @@ func Error(code int, message string) error {
 
 func Handle[T any, K any](fn func(ctx context.Context, input T) (out K, err error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := startHTTPSpan(r)
+		var err error
+		defer func() { tracing.EndSpan(span, err) }()
 		var args T
-		if err := parserArgument(r, &args); err != nil {
+		if err = parserArgument(r, &args); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		ret, err := fn(r.Context(), args)
+		ret, err := fn(ctx, args)
 		if err != nil {
 			var be *businessError
 			if errors.As(err, &be) {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/daemtri/begonia/bootstrap"
 	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/grpcx/tracing"
 	"github.com/go-chi/chi/v5"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -19,6 +20,7 @@ type Integrator struct {
 	Http   chi.Router
 	PubSub contract.PubSubConsumerRegistrar
 	Task   contract.TaskProcessorRegistrar
+	Health contract.HealthCheckRegistrar
 }
 
 func newIntegrator(
@@ -26,12 +28,14 @@ func newIntegrator(
 	psr contract.PubSubConsumerRegistrar,
 	tpr contract.TaskProcessorRegistrar,
 	mux chi.Router,
+	hc *bootstrap.HealthChecker,
 ) (*Integrator, error) {
 	reg := &Integrator{
 		Grpc:   lsr,
 		PubSub: psr,
 		Task:   tpr,
 		Http:   mux,
+		Health: hc,
 	}
 	return reg, nil
 }
@@ -49,6 +53,7 @@ func (it *Integrator) integrate(mr *moduleRuntime) {
 			PubSub: it.PubSub,
 			Task:   it.Task,
 			Http:   r,
+			Health: moduleHealthRegistrar{module: mr.moduleName, hc: it.Health},
 		})
 	})
 	currentModule = nil
@@ -57,11 +62,13 @@ func (it *Integrator) integrate(mr *moduleRuntime) {
 type GrpcServiceRegistrar interface {
 	contract.RouteRegistrar
 	grpc.ServiceRegistrar
+	// UseRouteInterceptor 添加模块级路由拦截器，只作用于当前模块注册的路由
+	UseRouteInterceptor(interceptors ...contract.RouteInterceptor)
 }
 
 type grpcServiceRegistrarImpl struct {
 	ci      *bootstrap.ContextInjector
-	route   contract.RouteRegistrar
+	route   *bootstrap.RouteRegistrar
 	service grpc.ServiceRegistrar
 }
 
@@ -86,27 +93,86 @@ func (gr *grpcServiceRegistrarImpl) RegisterService(desc *grpc.ServiceDesc, impl
 	gr.service.RegisterService(desc, impl)
 }
 
+// Route 注册无响应数据的路由
 func Route[K ~int32, T proto.Message](msgID K, handleFunc func(ctx context.Context, req T) error) contract.RouteCell {
 	mr := currentModule
+	name := routeRequestName[T]()
 	return contract.RouteCell{
 		MsgID: int32(msgID),
-		HandleFunc: func(ctx context.Context, req []byte) error {
-			var x T
-			v := x.ProtoReflect().New().Interface()
-			if req != nil {
-				if err := proto.Unmarshal(req, v); err != nil {
-					return status.Error(codes.InvalidArgument, fmt.Sprintf("message id %d does not match the message type, error %s", msgID, err))
-				}
+		HandleFunc: func(ctx context.Context, req []byte) (_ []byte, err error) {
+			ctx, span := startRouteSpan(ctx, name, int32(msgID), mr)
+			defer func() { tracing.EndSpan(span, err) }()
+			v, err := unmarshalRouteRequest[T](int32(msgID), req)
+			if err != nil {
+				return nil, err
 			}
-			return handleFunc(withObjectContainer(ctx, mr), v.(T))
+			return nil, handleFunc(withObjectContainer(ctx, mr), v)
 		},
 	}
 }
 
+// RouteReply 注册带响应数据的路由，响应会被序列化到 DispatchReply.Data 中
+func RouteReply[K ~int32, T, R proto.Message](msgID K, handleFunc func(ctx context.Context, req T) (R, error)) contract.RouteCell {
+	mr := currentModule
+	name := routeRequestName[T]()
+	return contract.RouteCell{
+		MsgID: int32(msgID),
+		HandleFunc: func(ctx context.Context, req []byte) (_ []byte, err error) {
+			ctx, span := startRouteSpan(ctx, name, int32(msgID), mr)
+			defer func() { tracing.EndSpan(span, err) }()
+			v, err := unmarshalRouteRequest[T](int32(msgID), req)
+			if err != nil {
+				return nil, err
+			}
+			reply, err := handleFunc(withObjectContainer(ctx, mr), v)
+			if err != nil {
+				return nil, err
+			}
+			data, err := proto.Marshal(reply)
+			if err != nil {
+				return nil, status.Error(codes.Internal, fmt.Sprintf("message id %d marshal reply error %s", msgID, err))
+			}
+			return data, nil
+		},
+	}
+}
+
+// routeRequestName 返回请求消息的proto全名
+func routeRequestName[T proto.Message]() string {
+	var x T
+	return string(x.ProtoReflect().Descriptor().FullName())
+}
+
+func unmarshalRouteRequest[T proto.Message](msgID int32, req []byte) (T, error) {
+	var x T
+	v := x.ProtoReflect().New().Interface()
+	if req != nil {
+		if err := proto.Unmarshal(req, v); err != nil {
+			return x, status.Error(codes.InvalidArgument, fmt.Sprintf("message id %d does not match the message type, error %s", msgID, err))
+		}
+	}
+	return v.(T), nil
+}
+
 func (gr *grpcServiceRegistrarImpl) RegisterRoute(routes ...contract.RouteCell) {
+	if currentModule != nil {
+		for i := range routes {
+			if routes[i].Module == "" {
+				routes[i].Module = currentModule.moduleName
+			}
+		}
+	}
 	gr.route.RegisterRoute(routes...)
 }
 
+func (gr *grpcServiceRegistrarImpl) UseRouteInterceptor(interceptors ...contract.RouteInterceptor) {
+	if currentModule == nil {
+		gr.route.Use(interceptors...)
+		return
+	}
+	gr.route.UseModule(currentModule.moduleName, interceptors...)
+}
+
 type httpServerMux struct {
 	chi.Router
 }
@@ -0,0 +1,90 @@
+// Package middleware 提供常用的路由拦截器，通过 app.UseRouteInterceptor 全局注册，
+// 或者在模块 Integrate 中通过 ig.Grpc.UseRouteInterceptor 注册到模块
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/app/header"
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/logx"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Logging 记录每个请求的msgid、模块、耗时和错误
+func Logging(logger *logx.Logger) contract.RouteInterceptor {
+	return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) ([]byte, error) {
+		start := time.Now()
+		reply, err := handler(ctx, req)
+		if err != nil {
+			logger.WarnContext(ctx, "route handle error", "msgid", info.MsgID, "module", info.Module, "elapsed", time.Since(start), "error", err)
+		} else {
+			logger.DebugContext(ctx, "route handled", "msgid", info.MsgID, "module", info.Module, "elapsed", time.Since(start))
+		}
+		return reply, err
+	}
+}
+
+// Metrics 每个请求结束后调用observe，用于按msgid上报耗时和错误
+func Metrics(observe func(ctx context.Context, info *contract.RouteInfo, elapsed time.Duration, err error)) contract.RouteInterceptor {
+	return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) ([]byte, error) {
+		start := time.Now()
+		reply, err := handler(ctx, req)
+		observe(ctx, info, time.Since(start), err)
+		return reply, err
+	}
+}
+
+// Recovery 捕获处理函数的panic并转换为 codes.Internal 错误
+func Recovery(logger *logx.Logger) contract.RouteInterceptor {
+	return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) (reply []byte, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.ErrorContext(ctx, "route handle panic", "msgid", info.MsgID, "module", info.Module, "panic", r, "stack", string(debug.Stack()))
+				reply, err = nil, status.Error(codes.Internal, fmt.Sprintf("msgid %d handle panic: %v", info.MsgID, r))
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RateLimit 按msgid限流，每个msgid使用独立的令牌桶，超过限制返回 codes.ResourceExhausted
+func RateLimit(limit rate.Limit, burst int) contract.RouteInterceptor {
+	var limiters sync.Map
+	return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) ([]byte, error) {
+		l, ok := limiters.Load(info.MsgID)
+		if !ok {
+			l, _ = limiters.LoadOrStore(info.MsgID, rate.NewLimiter(limit, burst))
+		}
+		if !l.(*rate.Limiter).Allow() {
+			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("msgid %d rate limit exceeded", info.MsgID))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Auth 校验请求中的用户信息，没有用户信息或者用户信息格式错误返回 codes.Unauthenticated
+// check 为nil时只校验用户信息是否存在，check返回的非status错误会转换为 codes.PermissionDenied
+func Auth(check func(ctx context.Context, user contract.UserInfoInterface, info *contract.RouteInfo) error) contract.RouteInterceptor {
+	return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) ([]byte, error) {
+		user, err := header.ParseUserInfoFromIncomingCtx(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, fmt.Sprintf("msgid %d requires user info: %s", info.MsgID, err))
+		}
+		if check != nil {
+			if err := check(ctx, user, info); err != nil {
+				if _, ok := status.FromError(err); ok {
+					return nil, err
+				}
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/daemtri/begonia/contract"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func echo(ctx context.Context, req []byte) ([]byte, error) {
+	return req, nil
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) contract.RouteInterceptor {
+		return func(ctx context.Context, req []byte, info *contract.RouteInfo, handler contract.RouteHandler) ([]byte, error) {
+			order = append(order, name)
+			return handler(ctx, req)
+		}
+	}
+	chain := contract.ChainRouteInterceptors(mark("a"), mark("b"), mark("c"))
+	reply, err := chain(context.Background(), []byte("x"), &contract.RouteInfo{MsgID: 1}, echo)
+	if err != nil || string(reply) != "x" {
+		t.Fatalf("unexpected reply %q %v", reply, err)
+	}
+	if len(order) != 3 || order[0] != "a" || order[2] != "c" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	rl := RateLimit(0, 1)
+	info := &contract.RouteInfo{MsgID: 1}
+	if _, err := rl(context.Background(), nil, info, echo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl(context.Background(), nil, info, echo); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+	if _, err := rl(context.Background(), nil, &contract.RouteInfo{MsgID: 2}, echo); err != nil {
+		t.Errorf("msgid 2 should not be limited, got %v", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	auth := Auth(func(ctx context.Context, user contract.UserInfoInterface, info *contract.RouteInfo) error {
+		if user.GetUserID() != 42 {
+			return errors.New("forbidden")
+		}
+		return nil
+	})
+	info := &contract.RouteInfo{MsgID: 1}
+	if _, err := auth(context.Background(), nil, info, echo); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	// 格式错误的用户信息不会导致panic
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user_id", "42", "tenant_id", "x"))
+	if _, err := auth(ctx, nil, info, echo); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("user_id", "7"))
+	if _, err := auth(ctx, nil, info, echo); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("user_id", "42"))
+	if _, err := auth(ctx, nil, info, echo); err != nil {
+		t.Errorf("expected success, got %v", err)
+	}
+}
@@ -40,6 +40,8 @@ func initModules() func(ctx context.Context) error {
 			defer cancel()
 			for i := range modules {
 				mr := modules[i]
+				// 先退出选举，OnElected中的任务在模块Destroy前结束
+				resignAll(wCtx, mr.takeCampaigns())
 				modules[i].module.Destroy(withObjectContainer(wCtx, mr))
 			}
 		}()
@@ -6,8 +6,15 @@ import (
 	"time"
 
 	"github.com/daemtri/begonia/driver/kafka"
+	"github.com/daemtri/begonia/grpcx/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/daemtri/begonia/app/pubsub"
+
 type kafkaMessage struct {
 	msg *kafka.Message
 }
@@ -20,6 +27,42 @@ func (m *kafkaMessage) Value() []byte {
 	return m.msg.Value
 }
 
+func (m *kafkaMessage) Carrier() propagation.TextMapCarrier {
+	return headerCarrier{headers: &m.msg.Headers}
+}
+
+// headerCarrier 使用kafka消息header传递W3C trace context
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i := range *c.headers {
+		if (*c.headers)[i].Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
 type kafkaPublisher struct {
 	producer *kafka.Producer
 }
@@ -31,12 +74,22 @@ func NewKafkaPublisher(producer *kafka.Producer) Publisher {
 	return p
 }
 
-func (ks *kafkaPublisher) Publish(ctx context.Context, msg Message) error {
-	return ks.producer.WriteMessage(ctx, kafka.Message{
+func (ks *kafkaPublisher) Publish(ctx context.Context, msg Message) (err error) {
+	ctx, span := tracing.Tracer(ctx, tracerName).Start(ctx, "publish "+msg.Topic(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKey.String(msg.Topic()),
+		),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+	km := kafka.Message{
 		Topic: msg.Topic(),
 		Key:   []byte(fmt.Sprintf("%d", time.Now().UnixNano())),
 		Value: msg.Value(),
-	})
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &km.Headers})
+	return ks.producer.WriteMessage(ctx, km)
 }
 
 type kafkaMessageReader struct {
@@ -59,6 +112,26 @@ func (km *kafkaMessageReader) Next() (Message, error) {
 	return km.prev, nil
 }
 
+func (km *kafkaMessageReader) Fetch(ctx context.Context) (Message, error) {
+	msg, err := km.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaMessage{msg: &msg}, nil
+}
+
+func (km *kafkaMessageReader) Commit(ctx context.Context, msg Message) error {
+	m, ok := msg.(*kafkaMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type %T", msg)
+	}
+	return km.reader.CommitMessages(ctx, *m.msg)
+}
+
+func (km *kafkaMessageReader) Close() error {
+	return km.reader.Close()
+}
+
 type kafkaSubscriber struct {
 	consumer *kafka.Consumer
 }
@@ -0,0 +1,32 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daemtri/begonia/driver/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	km := &kafka.Message{Topic: "orders", Headers: []kafka.Header{{Key: "traceparent", Value: []byte("stale")}}}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{headers: &km.Headers})
+	if len(km.Headers) != 1 {
+		t.Fatalf("expected traceparent header replaced, got %v", km.Headers)
+	}
+
+	got := trace.SpanContextFromContext(ExtractContext(context.Background(), &kafkaMessage{msg: km}))
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsRemote() {
+		t.Fatalf("unexpected span context %+v", got)
+	}
+}
@@ -1,6 +1,11 @@
 package pubsub
 
-import "context"
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
 
 type Message interface {
 	Topic() string
@@ -19,4 +24,24 @@ type MessageReader interface {
 	// Next returns the next message from the Reader.
 	// if pre message exists and not commit,this will commit it before read next message
 	Next() (Message, error)
+	// Fetch returns the next message from the Reader without committing any message,
+	// the message should be committed by Commit after it is processed.
+	Fetch(ctx context.Context) (Message, error)
+	// Commit commits the message returned by Fetch.
+	Commit(ctx context.Context, msg Message) error
+	// Close closes the reader, any blocked Fetch will return an error.
+	Close() error
+}
+
+// TraceCarrier 可以携带trace context的消息
+type TraceCarrier interface {
+	Carrier() propagation.TextMapCarrier
+}
+
+// ExtractContext 从消息中提取发送方的trace context，消息不支持时返回ctx
+func ExtractContext(ctx context.Context, msg Message) context.Context {
+	if tc, ok := msg.(TraceCarrier); ok {
+		return otel.GetTextMapPropagator().Extract(ctx, tc.Carrier())
+	}
+	return ctx
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/daemtri/begonia/driver/kafka"
 	"github.com/daemtri/begonia/driver/redis"
 	"github.com/daemtri/begonia/pkg/helper"
+	"github.com/daemtri/begonia/runtime"
 	"github.com/daemtri/begonia/runtime/component"
 )
 
@@ -84,6 +85,8 @@ func NewManager(ctx context.Context, configor component.Configurator) (*Manager,
 func (m *Manager) init(ctx context.Context) error {
 	cfg, err := m.configor.ReadConfig(ctx, "resources")
 	if err != nil {
+		// 没有资源配置时使用空配置，获取资源时返回config not found
+		m.config = &Config{}
 		return nil
 	}
 	var config Config
@@ -103,6 +106,7 @@ func (m *Manager) GetDB(ctx context.Context, name string) (*db.Database, error)
 		db, err := db.NewDB(&db.Options{
 			DriverName: cfg.Driver,
 			DSN:        cfg.DataSourceName,
+			Name:       name,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("open db %s error: %w", name, err)
@@ -132,9 +136,13 @@ func (m *Manager) GetMsgSubscriber(ctx context.Context, name string) (pubsub.Sub
 		if cfg == nil {
 			return nil, fmt.Errorf("kafka name %s config not found", name)
 		}
+		group := cfg.Group
+		if group == "" {
+			group = runtime.GetServiceName()
+		}
 		c, err := kafka.NewConsumer(&kafka.ConsumerOption{
 			Brokers: cfg.Brokers,
-			Group:   cfg.Group,
+			Group:   group,
 		})
 		if err != nil {
 			return nil, err
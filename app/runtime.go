@@ -9,10 +9,12 @@ import (
 	"github.com/daemtri/begonia/app/depency"
 	"github.com/daemtri/begonia/app/header"
 	"github.com/daemtri/begonia/app/pubsub"
+	"github.com/daemtri/begonia/app/schedule"
 	"github.com/daemtri/begonia/contract"
 	"github.com/daemtri/begonia/driver/db"
 	"github.com/daemtri/begonia/driver/redis"
 	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/metrics"
 	"github.com/daemtri/begonia/pkg/constraintx"
 	"github.com/daemtri/begonia/runtime/component"
 	"google.golang.org/grpc"
@@ -30,15 +32,23 @@ func GetLogger(ctx context.Context) *logx.Logger {
 	return logx.GetLogger("module:" + mr.moduleName)
 }
 
+// GetMetrics 获取当前模块的监控指标，注册的指标带有module标签
+func GetMetrics(ctx context.Context) *metrics.Module {
+	mr := objectContainerFromCtx(ctx)
+	return metrics.ForModule(mr.moduleName)
+}
+
 // GetLocker 获取分布式锁
 // 在同一个ctx上获取同一个key的锁，会直接返回同一个锁对象
 func GetLocker(ctx context.Context, key string) component.Locker {
 	return distrubutedLocker.GetLock(ctx, key)
 }
 
-// GetScheduler 获取定时器
-func GetScheduler(ctx context.Context) contract.Scheduler {
-	panic("unimplement")
+// GetScheduler 获取任务调度器
+// 添加的任务由注册了对应任务类型的模块通过 Integrator.Task.ProcessTask 处理
+// 迁移: 返回值由 contract.Scheduler 改为 schedule.Scheduler，见 contract.Scheduler
+func GetScheduler(ctx context.Context) schedule.Scheduler {
+	return taskScheduler
 }
 
 // GetMsgPublisher 获取消息队列
@@ -71,7 +81,7 @@ func GetService(ctx context.Context, name string) grpc.ClientConnInterface {
 		panic(fmt.Errorf("module %s not allow to call app %s", GeCurrentModule(ctx), name))
 	}
 	return servicesConns.MustGetOrInit(name, func() grpc.ClientConnInterface {
-		conn, err := grpcClientBuilder.NewGrpcClientConn(name, "grpc://", "")
+		conn, err := grpcClientBuilder.NewGrpcClientConn(name, grpcClientBuilder.Schema(), "")
 		if err != nil {
 			panic(fmt.Errorf("new grpc client error: name=%s,error=%s", name, err))
 		}
@@ -84,7 +94,7 @@ func GetCluster(ctx context.Context, name string, id string) grpc.ClientConnInte
 		panic(fmt.Errorf("module %s not allow to call app %s", GeCurrentModule(ctx), name))
 	}
 	conn := servicesConns.MustGetOrInit(name, func() grpc.ClientConnInterface {
-		conn, err := grpcClientBuilder.NewGrpcClientConn(name, "grpc://", id)
+		conn, err := grpcClientBuilder.NewGrpcClientConn(name, grpcClientBuilder.Schema(), id)
 		if err != nil {
 			panic(fmt.Errorf("new grpc client error: name=%s,error=%s", name, err))
 		}
@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrDuplicateTask 相同key的任务已经存在
+	ErrDuplicateTask = errors.New("schedule: task already exists")
+)
+
+// TaskMessage 为保存在 Backend 中的任务
+type TaskMessage struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Payload    []byte    `json:"payload"`
+	ScheduleAt time.Time `json:"schedule_at"`
+	Retried    int       `json:"retried"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Backend 任务存储后端
+type Backend interface {
+	// Enqueue 保存任务，如果相同ID的任务已经存在，返回 ErrDuplicateTask
+	Enqueue(ctx context.Context, msg *TaskMessage) error
+	// Dequeue 取出最多n个在now之前到期的任务，
+	// 取出的任务会被顺延lease时间，在此期间未被Ack的任务会被重新取出，
+	// 返回错误时也会返回已经取出的任务
+	Dequeue(ctx context.Context, now time.Time, n int, lease time.Duration) ([]*TaskMessage, error)
+	// Ack 任务处理成功，删除任务
+	Ack(ctx context.Context, msg *TaskMessage) error
+	// Retry 更新任务，并在at时刻重新投递
+	Retry(ctx context.Context, msg *TaskMessage, at time.Time) error
+	// Kill 删除任务，并将任务移入死信队列
+	Kill(ctx context.Context, msg *TaskMessage) error
+}
@@ -0,0 +1,88 @@
+package schedule
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryBackend 基于内存的任务存储，仅用于测试和单实例场景，进程退出后任务会丢失
+type MemoryBackend struct {
+	mux   sync.Mutex
+	tasks map[string]*TaskMessage
+	dead  []*TaskMessage
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		tasks: make(map[string]*TaskMessage),
+	}
+}
+
+func (mb *MemoryBackend) Enqueue(_ context.Context, msg *TaskMessage) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	if _, ok := mb.tasks[msg.ID]; ok {
+		return ErrDuplicateTask
+	}
+	x := *msg
+	mb.tasks[msg.ID] = &x
+	return nil
+}
+
+func (mb *MemoryBackend) Dequeue(_ context.Context, now time.Time, n int, lease time.Duration) ([]*TaskMessage, error) {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	due := make([]*TaskMessage, 0, n)
+	for _, task := range mb.tasks {
+		if !task.ScheduleAt.After(now) {
+			due = append(due, task)
+		}
+	}
+	slices.SortFunc(due, func(a, b *TaskMessage) int {
+		return a.ScheduleAt.Compare(b.ScheduleAt)
+	})
+	if len(due) > n {
+		due = due[:n]
+	}
+	ret := make([]*TaskMessage, 0, len(due))
+	for _, task := range due {
+		ret = append(ret, new(TaskMessage))
+		*ret[len(ret)-1] = *task
+		task.ScheduleAt = now.Add(lease)
+	}
+	return ret, nil
+}
+
+func (mb *MemoryBackend) Ack(_ context.Context, msg *TaskMessage) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	delete(mb.tasks, msg.ID)
+	return nil
+}
+
+func (mb *MemoryBackend) Retry(_ context.Context, msg *TaskMessage, at time.Time) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	x := *msg
+	x.ScheduleAt = at
+	mb.tasks[msg.ID] = &x
+	return nil
+}
+
+func (mb *MemoryBackend) Kill(_ context.Context, msg *TaskMessage) error {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	delete(mb.tasks, msg.ID)
+	x := *msg
+	mb.dead = append(mb.dead, &x)
+	return nil
+}
+
+// DeadTasks 返回死信队列中的任务
+func (mb *MemoryBackend) DeadTasks() []*TaskMessage {
+	mb.mux.Lock()
+	defer mb.mux.Unlock()
+	return slices.Clone(mb.dead)
+}
@@ -0,0 +1,201 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/logx"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	logger = logx.GetLogger("app/schedule")
+)
+
+// backendTimeout Ack、Retry、Kill 的超时时间，不受任务处理超时和退出的影响
+const backendTimeout = 5 * time.Second
+
+type Options struct {
+	PollInterval time.Duration `flag:"poll_interval" default:"1s" usage:"轮询到期任务的间隔"`
+	BatchSize    int           `flag:"batch_size" default:"32" usage:"每次轮询取出的最大任务数"`
+	Concurrency  int           `flag:"concurrency" default:"8" usage:"同时处理的最大任务数"`
+	Lease        time.Duration `flag:"lease" default:"1m" usage:"任务处理超时时间,超时未完成的任务会被重新投递"`
+	MaxRetry     int           `flag:"max_retry" default:"5" usage:"最大重试次数,超过后任务进入死信队列"`
+	MinBackoff   time.Duration `flag:"min_backoff" default:"1s" usage:"重试的最小退避时间"`
+	MaxBackoff   time.Duration `flag:"max_backoff" default:"5m" usage:"重试的最大退避时间"`
+}
+
+// Processor 实现了 Scheduler，并负责从 Backend 中取出到期任务，交给对应类型的处理器处理
+// 处理失败的任务会按指数退避重试，超过最大重试次数后进入死信队列
+type Processor struct {
+	opts    *Options
+	backend Backend
+
+	handlers map[string]func(context.Context, *contract.Task) error
+	stopping chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewProcessor(backend Backend, opts *Options) *Processor {
+	return &Processor{
+		opts:     opts,
+		backend:  backend,
+		handlers: make(map[string]func(context.Context, *contract.Task) error),
+		stopping: make(chan struct{}),
+	}
+}
+
+// Handle 注册任务处理器，必须在 Run 之前调用
+func (p *Processor) Handle(taskType string, handle func(context.Context, *contract.Task) error) {
+	if _, ok := p.handlers[taskType]; ok {
+		panic(fmt.Errorf("task %s already registered", taskType))
+	}
+	p.handlers[taskType] = handle
+}
+
+func (p *Processor) AddTask(ctx context.Context, typename string, task any, opts ...TaskOption) error {
+	to := taskOptions{}
+	for i := range opts {
+		opts[i].apply(&to)
+	}
+	payload, err := marshalPayload(task)
+	if err != nil {
+		return fmt.Errorf("marshal task %s error: %w", typename, err)
+	}
+	msg := &TaskMessage{
+		ID:         to.key,
+		Type:       typename,
+		Payload:    payload,
+		ScheduleAt: to.scheduleAt,
+	}
+	if msg.ID == "" {
+		msg.ID = ksuid.New().String()
+	}
+	if msg.ScheduleAt.IsZero() {
+		msg.ScheduleAt = time.Now()
+	}
+	return p.backend.Enqueue(ctx, msg)
+}
+
+func marshalPayload(task any) ([]byte, error) {
+	switch v := task.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case proto.Message:
+		return proto.Marshal(v)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func (p *Processor) Enabled() bool {
+	return len(p.handlers) > 0
+}
+
+func (p *Processor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.opts.PollInterval)
+	defer ticker.Stop()
+	sem := make(chan struct{}, max(p.opts.Concurrency, 1))
+	// 任务处理不跟随ctx取消,退出时等待处理中的任务完成
+	taskCtx := context.WithoutCancel(ctx)
+	defer p.wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.stopping:
+			return nil
+		case <-ticker.C:
+		}
+		free := cap(sem) - len(sem)
+		if free == 0 {
+			continue
+		}
+		// 出错时已经取出的任务仍然需要处理，否则要等到lease过期才会被重新投递
+		msgs, err := p.backend.Dequeue(ctx, time.Now(), min(free, p.opts.BatchSize), p.opts.Lease)
+		if err != nil {
+			logger.Warn("dequeue task error", "error", err, "dequeued", len(msgs))
+		}
+		for i := range msgs {
+			sem <- struct{}{}
+			p.wg.Add(1)
+			go func(msg *TaskMessage) {
+				defer func() {
+					<-sem
+					p.wg.Done()
+				}()
+				p.process(taskCtx, msg)
+			}(msgs[i])
+		}
+	}
+}
+
+func (p *Processor) process(ctx context.Context, msg *TaskMessage) {
+	handleCtx, cancel := context.WithTimeout(ctx, p.opts.Lease)
+	err := p.handle(handleCtx, msg)
+	cancel()
+
+	// 处理超时后handleCtx已经取消，更新任务状态使用独立的超时
+	ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), backendTimeout)
+	defer cancel()
+	if err == nil {
+		if err := p.backend.Ack(ctx, msg); err != nil {
+			logger.Error("ack task error", "id", msg.ID, "type", msg.Type, "error", err)
+		}
+		return
+	}
+	msg.LastError = err.Error()
+	if msg.Retried >= p.opts.MaxRetry {
+		logger.Error("task exceeded max retry, move to dead letter", "id", msg.ID, "type", msg.Type, "error", err)
+		if err := p.backend.Kill(ctx, msg); err != nil {
+			logger.Error("kill task error", "id", msg.ID, "type", msg.Type, "error", err)
+		}
+		return
+	}
+	backoff := p.backoff(msg.Retried)
+	msg.Retried++
+	msg.ScheduleAt = time.Now().Add(backoff)
+	logger.Warn("task failed, retry later", "id", msg.ID, "type", msg.Type, "retried", msg.Retried, "backoff", backoff, "error", err)
+	if err := p.backend.Retry(ctx, msg, msg.ScheduleAt); err != nil {
+		logger.Error("retry task error", "id", msg.ID, "type", msg.Type, "error", err)
+	}
+}
+
+func (p *Processor) handle(ctx context.Context, msg *TaskMessage) (err error) {
+	handle, ok := p.handlers[msg.Type]
+	if !ok {
+		return fmt.Errorf("no handler for task type %s", msg.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task handler panic: %v", r)
+		}
+	}()
+	task := contract.NewTask(msg.Type, msg.Payload)
+	task.ID = msg.ID
+	task.Retried = msg.Retried
+	task.ScheduleAt = msg.ScheduleAt
+	return handle(ctx, task)
+}
+
+func (p *Processor) backoff(retried int) time.Duration {
+	d := p.opts.MinBackoff
+	for i := 0; i < retried && d < p.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.opts.MaxBackoff)
+}
+
+func (p *Processor) GracefulStop() {
+	p.stopOnce.Do(func() { close(p.stopping) })
+}
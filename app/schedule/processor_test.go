@@ -0,0 +1,88 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/contract"
+)
+
+func newTestProcessor(backend Backend) *Processor {
+	return NewProcessor(backend, &Options{
+		PollInterval: 5 * time.Millisecond,
+		BatchSize:    8,
+		Concurrency:  2,
+		Lease:        time.Second,
+		MaxRetry:     2,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   4 * time.Millisecond,
+	})
+}
+
+func TestProcessorDeliver(t *testing.T) {
+	p := newTestProcessor(NewMemoryBackend())
+	received := make(chan *contract.Task, 1)
+	p.Handle("hello", func(ctx context.Context, task *contract.Task) error {
+		received <- task
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	if err := p.AddTask(ctx, "hello", "world", WithScheduleAt(time.Now().Add(20*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case task := <-received:
+		if task.Type() != "hello" || string(task.Payload()) != "world" {
+			t.Errorf("unexpected task %s %s", task.Type(), task.Payload())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not delivered")
+	}
+}
+
+func TestProcessorDedup(t *testing.T) {
+	p := newTestProcessor(NewMemoryBackend())
+	if err := p.AddTask(context.Background(), "hello", nil, WithKey("k1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddTask(context.Background(), "hello", nil, WithKey("k1")); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("expected ErrDuplicateTask, got %v", err)
+	}
+}
+
+func TestProcessorDeadLetter(t *testing.T) {
+	backend := NewMemoryBackend()
+	p := newTestProcessor(backend)
+	var calls atomic.Int32
+	p.Handle("fail", func(ctx context.Context, task *contract.Task) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	if err := p.AddTask(ctx, "fail", []byte("x"), WithKey("dead")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(time.Second)
+	for len(backend.DeadTasks()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("task not moved to dead letter")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 calls, got %d", n)
+	}
+	if dead := backend.DeadTasks()[0]; dead.ID != "dead" || dead.Retried != 2 || dead.LastError != "boom" {
+		t.Errorf("unexpected dead task %+v", dead)
+	}
+}
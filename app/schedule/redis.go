@@ -2,21 +2,139 @@ package schedule
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
-	"github.com/daemtri/begonia/driver/kafka"
+	"github.com/daemtri/begonia/driver/redis"
+	goredis "github.com/redis/go-redis/v9"
 )
 
-type kafkaScheduler struct {
-	producer *kafka.Producer
+// enqueueScript KEYS[1]=zset KEYS[2]=hash ARGV[1]=id ARGV[2]=score ARGV[3]=task
+var enqueueScript = goredis.NewScript(`
+if redis.call("HSETNX", KEYS[2], ARGV[1], ARGV[3]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1`)
+
+// dequeueScript KEYS[1]=zset KEYS[2]=hash ARGV[1]=now ARGV[2]=limit ARGV[3]=lease deadline
+// 返回 id1, task1, id2, task2 ...
+var dequeueScript = goredis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+local tasks = {}
+for _, id in ipairs(ids) do
+	local task = redis.call("HGET", KEYS[2], id)
+	if task then
+		redis.call("ZADD", KEYS[1], ARGV[3], id)
+		table.insert(tasks, id)
+		table.insert(tasks, task)
+	else
+		redis.call("ZREM", KEYS[1], id)
+	end
+end
+return tasks`)
+
+// RedisBackend 基于redis有序集合的任务存储
+// 任务ID按执行时间保存在有序集合中，任务内容保存在hash中，死信保存在list中
+type RedisBackend struct {
+	client *redis.Redis
+
+	scheduleKey string
+	tasksKey    string
+	deadKey     string
 }
 
-func NewKafkaScheduler(producer *kafka.Producer) Scheduler {
-	p := &kafkaScheduler{
-		producer: producer,
+func NewRedisBackend(client *redis.Redis, queue string) *RedisBackend {
+	return &RedisBackend{
+		client: client,
+		// hash tag保证同一个队列的key在redis cluster的同一个slot，lua脚本和事务同时使用这些key
+		scheduleKey: fmt.Sprintf("app:schedule:{%s}:zset", queue),
+		tasksKey:    fmt.Sprintf("app:schedule:{%s}:tasks", queue),
+		deadKey:     fmt.Sprintf("app:schedule:{%s}:dead", queue),
 	}
-	return p
 }
 
-func (ks *kafkaScheduler) AddTask(ctx context.Context, typename string, task any, opts ...TaskOption) error {
+func (rb *RedisBackend) Enqueue(ctx context.Context, msg *TaskMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ok, err := enqueueScript.Run(ctx, rb.client,
+		[]string{rb.scheduleKey, rb.tasksKey},
+		msg.ID, msg.ScheduleAt.UnixMilli(), data,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrDuplicateTask
+	}
 	return nil
 }
+
+func (rb *RedisBackend) Dequeue(ctx context.Context, now time.Time, n int, lease time.Duration) ([]*TaskMessage, error) {
+	values, err := dequeueScript.Run(ctx, rb.client,
+		[]string{rb.scheduleKey, rb.tasksKey},
+		now.UnixMilli(), n, now.Add(lease).UnixMilli(),
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*TaskMessage, 0, len(values)/2)
+	var errs []error
+	for i := 0; i+1 < len(values); i += 2 {
+		var msg TaskMessage
+		if err := json.Unmarshal([]byte(values[i+1]), &msg); err != nil {
+			// 无法解析的任务直接移入死信队列，避免每次lease过期后被重复取出
+			errs = append(errs, fmt.Errorf("invalid task %s: %w", values[i], err))
+			if err := rb.killRaw(ctx, values[i], values[i+1]); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		tasks = append(tasks, &msg)
+	}
+	return tasks, errors.Join(errs...)
+}
+
+func (rb *RedisBackend) Ack(ctx context.Context, msg *TaskMessage) error {
+	_, err := rb.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.ZRem(ctx, rb.scheduleKey, msg.ID)
+		pipe.HDel(ctx, rb.tasksKey, msg.ID)
+		return nil
+	})
+	return err
+}
+
+func (rb *RedisBackend) Retry(ctx context.Context, msg *TaskMessage, at time.Time) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = rb.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, rb.tasksKey, msg.ID, data)
+		pipe.ZAdd(ctx, rb.scheduleKey, goredis.Z{Score: float64(at.UnixMilli()), Member: msg.ID})
+		return nil
+	})
+	return err
+}
+
+func (rb *RedisBackend) Kill(ctx context.Context, msg *TaskMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return rb.killRaw(ctx, msg.ID, string(data))
+}
+
+func (rb *RedisBackend) killRaw(ctx context.Context, id string, data string) error {
+	_, err := rb.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.ZRem(ctx, rb.scheduleKey, id)
+		pipe.HDel(ctx, rb.tasksKey, id)
+		pipe.LPush(ctx, rb.deadKey, data)
+		return nil
+	})
+	return err
+}
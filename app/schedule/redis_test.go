@@ -0,0 +1,138 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daemtri/begonia/driver/redis"
+)
+
+func newTestRedisBackend(t *testing.T) (*RedisBackend, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedis(context.Background(), &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewRedisBackend(client, "test"), mr
+}
+
+func TestRedisBackendEnqueue(t *testing.T) {
+	rb, _ := newTestRedisBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	msg := &TaskMessage{ID: "t1", Type: "hello", Payload: []byte("world"), ScheduleAt: now}
+	if err := rb.Enqueue(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.Enqueue(ctx, msg); !errors.Is(err, ErrDuplicateTask) {
+		t.Fatalf("expected ErrDuplicateTask, got %v", err)
+	}
+	// 未到期的任务不会被取出
+	if err := rb.Enqueue(ctx, &TaskMessage{ID: "t2", Type: "hello", ScheduleAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := rb.Dequeue(ctx, now, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != "t1" || string(tasks[0].Payload) != "world" {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+}
+
+func TestRedisBackendDequeueLease(t *testing.T) {
+	rb, _ := newTestRedisBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	if err := rb.Enqueue(ctx, &TaskMessage{ID: "t1", Type: "hello", ScheduleAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err := rb.Dequeue(ctx, now, 10, time.Minute); err != nil || len(tasks) != 1 {
+		t.Fatalf("dequeue: %v %d", err, len(tasks))
+	}
+	// lease期间不会被重复取出
+	if tasks, err := rb.Dequeue(ctx, now.Add(time.Second), 10, time.Minute); err != nil || len(tasks) != 0 {
+		t.Fatalf("dequeue during lease: %v %d", err, len(tasks))
+	}
+	// lease过期后未Ack的任务被重新取出
+	tasks, err := rb.Dequeue(ctx, now.Add(2*time.Minute), 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("dequeue after lease: %v %d", err, len(tasks))
+	}
+	if err := rb.Ack(ctx, tasks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err := rb.Dequeue(ctx, now.Add(time.Hour), 10, time.Minute); err != nil || len(tasks) != 0 {
+		t.Fatalf("dequeue after ack: %v %d", err, len(tasks))
+	}
+}
+
+func TestRedisBackendRetry(t *testing.T) {
+	rb, _ := newTestRedisBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	if err := rb.Enqueue(ctx, &TaskMessage{ID: "t1", Type: "hello", ScheduleAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := rb.Dequeue(ctx, now, 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("dequeue: %v %d", err, len(tasks))
+	}
+	msg := tasks[0]
+	msg.Retried++
+	msg.LastError = "failed"
+	if err := rb.Retry(ctx, msg, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err = rb.Dequeue(ctx, now.Add(time.Second), 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("dequeue after retry: %v %d", err, len(tasks))
+	}
+	if tasks[0].Retried != 1 || tasks[0].LastError != "failed" {
+		t.Errorf("retry not saved: %+v", tasks[0])
+	}
+}
+
+func TestRedisBackendKill(t *testing.T) {
+	rb, mr := newTestRedisBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	if err := rb.Enqueue(ctx, &TaskMessage{ID: "t1", Type: "hello", ScheduleAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := rb.Dequeue(ctx, now, 10, time.Minute)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("dequeue: %v %d", err, len(tasks))
+	}
+	if err := rb.Kill(ctx, tasks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err := rb.Dequeue(ctx, now.Add(time.Hour), 10, time.Minute); err != nil || len(tasks) != 0 {
+		t.Fatalf("dequeue after kill: %v %d", err, len(tasks))
+	}
+	dead, err := mr.List(rb.deadKey)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("dead letter: %v %d", err, len(dead))
+	}
+
+	// 无法解析的任务移入死信队列，同一批次的其他任务正常返回
+	mr.HSet(rb.tasksKey, "bad", "{")
+	mr.ZAdd(rb.scheduleKey, float64(now.UnixMilli()), "bad")
+	if err := rb.Enqueue(ctx, &TaskMessage{ID: "t2", Type: "hello", ScheduleAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err = rb.Dequeue(ctx, now, 10, time.Minute)
+	if err == nil {
+		t.Error("expected invalid task error")
+	}
+	if len(tasks) != 1 || tasks[0].ID != "t2" {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+	if dead, _ := mr.List(rb.deadKey); len(dead) != 2 {
+		t.Errorf("invalid task not killed, dead letter %d", len(dead))
+	}
+}
@@ -5,16 +5,10 @@ import (
 	"time"
 )
 
-type Task struct {
-	typename   string
-	payload    []byte
-	ScheduleAt time.Time
-}
-
-func (t *Task) Type() string    { return t.typename }
-func (t *Task) Payload() []byte { return t.payload }
-
+// Scheduler 任务调度器，用于添加延时任务
 type Scheduler interface {
+	// AddTask 添加一个任务，task 支持 proto.Message、[]byte、string，其他类型使用json序列化
+	// 使用 WithKey 添加的任务，在任务处理完成前，重复添加同一个key会返回 ErrDuplicateTask
 	AddTask(cxt context.Context, typename string, task any, opts ...TaskOption) error
 }
 
@@ -33,12 +27,14 @@ func (f funcTaskOption) apply(opts *taskOptions) {
 	f(opts)
 }
 
+// WithScheduleAt 设置任务的执行时间，默认立即执行
 func WithScheduleAt(scheduleAt time.Time) TaskOption {
 	return funcTaskOption(func(opts *taskOptions) {
 		opts.scheduleAt = scheduleAt
 	})
 }
 
+// WithKey 设置任务的唯一key，用于任务去重
 func WithKey(key string) TaskOption {
 	return funcTaskOption(func(opts *taskOptions) {
 		opts.key = key
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
 	"slices"
 	"strconv"
@@ -66,17 +67,31 @@ func serviceRegister() {
 		logger.Error("服务注册出错", "error", err)
 		return
 	}
+	defer func() {
+		dCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := discovery.Deregister(dCtx, serviceEntry); err != nil {
+			logger.Error("服务注销出错", "error", err)
+		}
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
+		select {
+		case <-ctx.Done():
+			// 主进程PreStop时会发送SIGTERM
+			return
+		case <-ticker.C:
+		}
 		// linux 已经注册了 PdeathSig,windows和mac不支持,暂时这样处理
 		if os.Getppid() != ppid {
-			// TODO: call DeRegister
 			return
 		}
-		time.Sleep(time.Second)
 	}
 }
 
-func initRegisterApp(ctx context.Context, discovery component.Discovery, servers []bootstrap.Server) error {
+// initRegisterApp 注册服务，sidecar模式下返回sidecar进程，用于退出时通知sidecar注销服务
+func initRegisterApp(ctx context.Context, discovery component.Discovery, servers []bootstrap.Server) (*exec.Cmd, error) {
 	for i := range servers {
 		if !servers[i].Enabled() {
 			continue
@@ -84,12 +99,12 @@ func initRegisterApp(ctx context.Context, discovery component.Discovery, servers
 		addr := servers[i].BroadCastAddr()
 		parsedAddr, err := url.Parse(addr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if parsedAddr.Hostname() == "" || parsedAddr.Hostname() == "0.0.0.0" {
 			localIP, err := getBroadCastHost()
 			if err != nil {
-				return err
+				return nil, err
 			}
 			addr = fmt.Sprintf("%s://%s:%s", parsedAddr.Scheme, localIP, parsedAddr.Port())
 		}
@@ -97,7 +112,7 @@ func initRegisterApp(ctx context.Context, discovery component.Discovery, servers
 	}
 	if len(runtime.GetServiceEndpoints()) == 0 {
 		logger.Info("服务注册中断,未发现Endpoints")
-		return nil
+		return nil, nil
 	}
 
 	logger.Info("开始服务注册",
@@ -112,7 +127,7 @@ func initRegisterApp(ctx context.Context, discovery component.Discovery, servers
 	if enableSideCarMode {
 		ses, err := json.Marshal(runtime.GetServiceEntry())
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		box.FlagSet("xxx")
@@ -131,16 +146,16 @@ func initRegisterApp(ctx context.Context, discovery component.Discovery, servers
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Start(); err != nil {
-			return fmt.Errorf("failed to run command %w", err)
+			return nil, fmt.Errorf("failed to run command %w", err)
 		}
 		go func() {
 			if err := cmd.Wait(); err != nil {
 				logger.Warn("failed to run command", "error", err)
 			}
 		}()
-		return nil
+		return cmd, nil
 	}
-	return discovery.Register(ctx, runtime.GetServiceEntry())
+	return nil, discovery.Register(ctx, runtime.GetServiceEntry())
 }
 
 func getBroadCastHost() (string, error) {
@@ -182,19 +197,28 @@ func getStringsOpt(name string) []string {
 type serviceRegisterRunable struct {
 	servers   []bootstrap.Server
 	discovery component.Discovery
+
+	registered chan struct{}
+	sidecar    *exec.Cmd
 }
 
 func NewServiceRegisterRunable(ctx context.Context) *serviceRegisterRunable {
 	return &serviceRegisterRunable{
-		servers:   box.Invoke[container.Set[bootstrap.Server]](ctx),
-		discovery: box.Invoke[component.Discovery](ctx),
+		servers:    box.Invoke[container.Set[bootstrap.Server]](ctx),
+		discovery:  box.Invoke[component.Discovery](ctx),
+		registered: make(chan struct{}),
 	}
 }
 
 func (s *serviceRegisterRunable) Run(ctx context.Context) error {
-	if err := initRegisterApp(ctx, s.discovery, s.servers); err != nil {
+	sidecar, err := initRegisterApp(ctx, s.discovery, s.servers)
+	if err != nil {
 		return err
 	}
+	s.sidecar = sidecar
+	if len(runtime.GetServiceEndpoints()) > 0 {
+		close(s.registered)
+	}
 	<-ctx.Done()
 	return nil
 }
@@ -203,4 +227,27 @@ func (s *serviceRegisterRunable) Enabled() bool {
 	return true
 }
 
+// PreStop 注销服务，并等待drainPeriod，让客户端的grpcresolver有时间移除当前实例
+func (s *serviceRegisterRunable) PreStop(ctx context.Context) {
+	select {
+	case <-s.registered:
+	default:
+		return
+	}
+	if s.sidecar != nil {
+		if err := s.sidecar.Process.Signal(syscall.SIGTERM); err != nil {
+			logger.Warn("通知sidecar注销服务出错", "error", err)
+		}
+	} else {
+		dCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := s.discovery.Deregister(dCtx, runtime.GetServiceEntry())
+		cancel()
+		if err != nil {
+			logger.Warn("服务注销出错", "error", err)
+		}
+	}
+	logger.Info("服务已注销,等待流量排空", "drain", drainPeriod)
+	time.Sleep(drainPeriod)
+}
+
 func (s *serviceRegisterRunable) GracefulStop() {}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/app/resources"
+	"github.com/daemtri/begonia/app/schedule"
+	"github.com/daemtri/begonia/contract"
+	"github.com/daemtri/begonia/runtime"
+)
+
+type schedulerOption struct {
+	Driver string `flag:"driver" default:"redis" usage:"任务存储后端,可选: redis|memory,memory仅用于测试,进程退出后任务丢失且不在实例间共享"`
+	Redis  string `flag:"redis" default:"" usage:"使用redis存储时的redis资源名"`
+	Queue  string `flag:"queue" default:"" usage:"任务队列名,默认为服务名"`
+
+	schedule.Options `flag:""`
+}
+
+func newTaskProcessor(ctx context.Context, opt *schedulerOption, rm *resources.Manager) (*schedule.Processor, error) {
+	var backend schedule.Backend
+	switch opt.Driver {
+	case "memory":
+		backend = schedule.NewMemoryBackend()
+	case "redis":
+		queue := opt.Queue
+		if queue == "" {
+			queue = runtime.GetServiceName()
+		}
+		backend = &lazyRedisBackend{ctx: ctx, name: opt.Redis, queue: queue, rm: rm}
+	default:
+		return nil, fmt.Errorf("unsupported schedule driver %s", opt.Driver)
+	}
+	return schedule.NewProcessor(backend, &opt.Options), nil
+}
+
+// lazyRedisBackend 第一次使用时才获取redis资源，没有使用任务的服务不需要配置redis
+type lazyRedisBackend struct {
+	ctx   context.Context
+	name  string
+	queue string
+	rm    *resources.Manager
+
+	mux     sync.Mutex
+	backend *schedule.RedisBackend
+}
+
+func (lb *lazyRedisBackend) get() (*schedule.RedisBackend, error) {
+	lb.mux.Lock()
+	defer lb.mux.Unlock()
+	if lb.backend == nil {
+		rds, err := lb.rm.GetRedis(lb.ctx, lb.name)
+		if err != nil {
+			return nil, fmt.Errorf("schedule redis backend: %w", err)
+		}
+		lb.backend = schedule.NewRedisBackend(rds, lb.queue)
+	}
+	return lb.backend, nil
+}
+
+func (lb *lazyRedisBackend) Enqueue(ctx context.Context, msg *schedule.TaskMessage) error {
+	b, err := lb.get()
+	if err != nil {
+		return err
+	}
+	return b.Enqueue(ctx, msg)
+}
+
+func (lb *lazyRedisBackend) Dequeue(ctx context.Context, now time.Time, n int, lease time.Duration) ([]*schedule.TaskMessage, error) {
+	b, err := lb.get()
+	if err != nil {
+		return nil, err
+	}
+	return b.Dequeue(ctx, now, n, lease)
+}
+
+func (lb *lazyRedisBackend) Ack(ctx context.Context, msg *schedule.TaskMessage) error {
+	b, err := lb.get()
+	if err != nil {
+		return err
+	}
+	return b.Ack(ctx, msg)
+}
+
+func (lb *lazyRedisBackend) Retry(ctx context.Context, msg *schedule.TaskMessage, at time.Time) error {
+	b, err := lb.get()
+	if err != nil {
+		return err
+	}
+	return b.Retry(ctx, msg, at)
+}
+
+func (lb *lazyRedisBackend) Kill(ctx context.Context, msg *schedule.TaskMessage) error {
+	b, err := lb.get()
+	if err != nil {
+		return err
+	}
+	return b.Kill(ctx, msg)
+}
+
+// taskProcessorRegistrar 实现contract.TaskProcessorRegistrar
+type taskProcessorRegistrar struct {
+	processor *schedule.Processor
+}
+
+func newTaskProcessorRegistrar(processor *schedule.Processor) (*taskProcessorRegistrar, error) {
+	return &taskProcessorRegistrar{processor: processor}, nil
+}
+
+func (tpr *taskProcessorRegistrar) ProcessTask(taskType string, handle func(context.Context, *contract.Task) error) {
+	mr := currentModule
+	tpr.processor.Handle(taskType, func(ctx context.Context, task *contract.Task) error {
+		return handle(withObjectContainer(ctx, mr), task)
+	})
+}
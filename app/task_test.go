@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/daemtri/begonia/app/resources"
+	"github.com/daemtri/begonia/app/schedule"
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+// emptyConfigurator 没有任何配置
+type emptyConfigurator struct {
+	component.Configurator
+}
+
+func (emptyConfigurator) ReadConfig(ctx context.Context, name string) (component.ConfigDecoder, error) {
+	return nil, errors.New("config not found")
+}
+
+func TestTaskProcessorRedisLazy(t *testing.T) {
+	ctx := context.Background()
+	rm, err := resources.NewManager(ctx, emptyConfigurator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 默认使用redis，没有使用任务时不需要配置redis
+	p, err := newTaskProcessor(ctx, &schedulerOption{Driver: "redis"}, rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.AddTask(ctx, "test", []byte("payload"), schedule.WithKey("1"))
+	if err == nil || !strings.Contains(err.Error(), "config not found") {
+		t.Fatalf("expected redis config error, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/daemtri/begonia/app/pubsub"
+	"github.com/daemtri/begonia/bootstrap"
+	"github.com/daemtri/begonia/di/box"
+	"github.com/daemtri/begonia/grpcx/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/daemtri/begonia/app"
+
+// setGlobalTracerProvider 创建进程共享的TracerProvider，同时设置为全局TracerProvider
+func setGlobalTracerProvider(ctx context.Context) error {
+	_, err := box.Invoke[*tracing.Factory](ctx).TracerProvider("app")
+	return err
+}
+
+// tracerProviderStopper engine退出后导出缓存的span并关闭共享的TracerProvider
+// 在PostStop中关闭，保证服务停止过程中产生的span也能导出
+type tracerProviderStopper struct {
+	factory *tracing.Factory
+}
+
+func newTracerProviderStopper(f *tracing.Factory) bootstrap.Runable {
+	return &tracerProviderStopper{factory: f}
+}
+
+func (s *tracerProviderStopper) Enabled() bool {
+	return true
+}
+
+func (s *tracerProviderStopper) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *tracerProviderStopper) GracefulStop() {}
+
+func (s *tracerProviderStopper) PostStop(ctx context.Context) {
+	if err := s.factory.Shutdown(ctx); err != nil {
+		logger.Warn("tracer provider shutdown error", "error", err)
+	}
+}
+
+// startRouteSpan 为路由处理创建span，父span是BusinessService.Dispatch的gRPC span
+// name 为请求消息的proto全名
+func startRouteSpan(ctx context.Context, name string, msgID int32, mr *moduleRuntime) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{tracing.MsgIDKey.Int(int(msgID))}
+	if mr != nil {
+		attrs = append(attrs, attribute.String("begonia.module", mr.moduleName))
+	}
+	return tracing.Tracer(ctx, tracerName).Start(ctx, "route "+name, trace.WithAttributes(attrs...))
+}
+
+// startHTTPSpan 为http处理创建span，从请求header中提取W3C trace context
+func startHTTPSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracing.Tracer(ctx, tracerName).Start(ctx, "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPTargetKey.String(r.URL.Path),
+		),
+	)
+}
+
+// startConsumeSpan 为消息处理创建span，父span是发送消息时的span
+func startConsumeSpan(ctx context.Context, sub *subscription, msg pubsub.Message) (context.Context, trace.Span) {
+	ctx = pubsub.ExtractContext(ctx, msg)
+	return tracing.Tracer(ctx, tracerName).Start(ctx, "consume "+msg.Topic(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKey.String(msg.Topic()),
+			semconv.MessagingOperationProcess,
+			attribute.String("begonia.module", sub.module.moduleName),
+		),
+	)
+}
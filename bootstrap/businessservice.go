@@ -3,12 +3,35 @@ package bootstrap
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/daemtri/begonia/api/transmit"
+	"github.com/daemtri/begonia/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// unknownMsgID 未注册的msgid在指标中的标签值
+const unknownMsgID = "unknown"
+
+var (
+	dispatchHandled = metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "dispatch",
+		Name:      "handled_total",
+		Help:      "按msgid统计的消息处理数",
+	}, []string{"msgid", "code"}))
+	dispatchHandling = metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "dispatch",
+		Name:      "handling_seconds",
+		Help:      "按msgid统计的消息处理耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"msgid"}))
+)
+
 type BusinessService struct {
 	transmit.UnimplementedBusinessServiceServer
 
@@ -23,13 +46,20 @@ func NewBusinessService(rr *RouteRegistrar) (*BusinessService, error) {
 }
 
 func (bs *BusinessService) Dispatch(ctx context.Context, req *transmit.DispatchRequest) (*transmit.DispatchReply, error) {
-	h, ok := bs.rr.routes[req.Msgid]
+	h, ok := bs.rr.lookup(req.Msgid)
 	if !ok {
+		// msgid由调用方传入，未注册的msgid统一计数，避免产生无限的指标序列
+		dispatchHandled.WithLabelValues(unknownMsgID, codes.Unimplemented.String()).Inc()
 		return nil, status.Error(codes.Unimplemented, fmt.Sprintf("unknown msgid %d", req.Msgid))
 	}
 
-	if err := h(ctx, req.Data); err != nil {
+	msgid := strconv.FormatInt(int64(req.Msgid), 10)
+	start := time.Now()
+	data, err := h(ctx, req.Data)
+	dispatchHandling.WithLabelValues(msgid).Observe(time.Since(start).Seconds())
+	dispatchHandled.WithLabelValues(msgid, status.Code(err).String()).Inc()
+	if err != nil {
 		return nil, status.Convert(err).Err()
 	}
-	return &transmit.DispatchReply{}, nil
+	return &transmit.DispatchReply{Data: data}, nil
 }
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daemtri/begonia/api/transmit"
+	"github.com/daemtri/begonia/contract"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBusinessServiceDispatch(t *testing.T) {
+	rr, _ := NewRouteRegistrar()
+	rr.RegisterRoute(contract.RouteCell{
+		MsgID: 1,
+		HandleFunc: func(ctx context.Context, req []byte) ([]byte, error) {
+			return append([]byte("echo:"), req...), nil
+		},
+	})
+	bs, _ := NewBusinessService(rr)
+
+	reply, err := bs.Dispatch(context.Background(), &transmit.DispatchRequest{Msgid: 1, Data: []byte("hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Data) != "echo:hi" {
+		t.Errorf("unexpected reply data %q", reply.Data)
+	}
+
+	for _, msgid := range []int32{2, 3} {
+		_, err = bs.Dispatch(context.Background(), &transmit.DispatchRequest{Msgid: msgid})
+		if status.Code(err) != codes.Unimplemented {
+			t.Errorf("expected Unimplemented, got %v", err)
+		}
+	}
+	// 未注册的msgid不作为指标标签
+	if n := testutil.ToFloat64(dispatchHandled.WithLabelValues(unknownMsgID, codes.Unimplemented.String())); n != 2 {
+		t.Errorf("expected 2 unknown msgid, got %v", n)
+	}
+	if n := testutil.CollectAndCount(dispatchHandled); n != 2 {
+		t.Errorf("expected 2 series, got %d", n)
+	}
+}
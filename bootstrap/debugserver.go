@@ -6,18 +6,33 @@ import (
 	"time"
 
 	"github.com/arl/statsviz"
+	"github.com/daemtri/begonia/metrics"
 	"github.com/maruel/panicparse/v2/stack/webstack"
 )
 
-type DebugServer struct {
+type DebugServerRunOption struct {
 	Enable bool   `flag:"enable" default:"false" usage:"是否开启debug http服务"`
 	Addr   string `flag:"addr" default:":8078" usage:"debug http服务监听地址"`
+}
+
+type DebugServer struct {
+	opt      *DebugServerRunOption
+	hc       *HealthChecker
+	server   *http.Server
+	handlers map[string]http.Handler
+}
+
+func NewDebugServer(opt *DebugServerRunOption, hc *HealthChecker) (*DebugServer, error) {
+	return &DebugServer{opt: opt, hc: hc, handlers: make(map[string]http.Handler)}, nil
+}
 
-	server *http.Server
+// Handle 添加debug接口，Run时注册，必须在Run之前调用
+func (s *DebugServer) Handle(pattern string, handler http.Handler) {
+	s.handlers[pattern] = handler
 }
 
 func (s *DebugServer) Enabled() bool {
-	return s.Enable
+	return s.opt.Enable
 }
 
 func (s *DebugServer) BroadCastAddr() string {
@@ -32,11 +47,19 @@ func (s *DebugServer) Run(_ context.Context) error {
 	}
 	// 漂亮的Goroutine打印
 	http.HandleFunc("/debug/panicparse", webstack.SnapshotHandler)
+	// 健康检查
+	http.Handle("/healthz", s.hc)
+	http.Handle("/readyz", s.hc)
+	// prometheus监控指标
+	http.Handle("/metrics", metrics.Handler())
+	for pattern, handler := range s.handlers {
+		http.Handle(pattern, handler)
+	}
 	s.server = &http.Server{
 		Handler: http.DefaultServeMux,
-		Addr:    s.Addr,
+		Addr:    s.opt.Addr,
 	}
-	logger.Info("debug server已启动", "addr", s.Addr)
+	logger.Info("debug server已启动", "addr", s.opt.Addr)
 	return s.server.ListenAndServe()
 }
 
@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	"context"
+	"sync"
 
 	"github.com/daemtri/begonia/di/container"
 	"github.com/daemtri/begonia/logx"
@@ -18,6 +19,18 @@ type Runable interface {
 	GracefulStop()
 }
 
+// PreStopper 可选接口，engine退出时会先调用所有Runable的PreStop，全部返回后再调用GracefulStop
+// 用于在服务停止前注销服务发现并等待流量排空
+type PreStopper interface {
+	PreStop(ctx context.Context)
+}
+
+// PostStopper 可选接口，所有Runable的GracefulStop返回后调用
+// 用于释放服务停止过程中仍然需要使用的资源，如服务发现的watch、trace导出
+type PostStopper interface {
+	PostStop(ctx context.Context)
+}
+
 type Server interface {
 	Runable
 	BroadCastAddr() string
@@ -49,13 +62,45 @@ func (engine *EngineImpl) Run(ctx context.Context) error {
 	group.Go(func() error {
 		defer logx.Recover(logger)
 		<-ctx.Done()
+		engine.preStop()
 		for _, runable := range engine.runables {
 			if runable.Enabled() {
 				runable.GracefulStop()
 			}
 		}
+		engine.postStop()
 		return nil
 	})
 
 	return group.Wait()
 }
+
+func (engine *EngineImpl) preStop() {
+	var wg sync.WaitGroup
+	for _, runable := range engine.runables {
+		if ps, ok := runable.(PreStopper); ok && runable.Enabled() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer logx.Recover(logger)
+				ps.PreStop(context.Background())
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func (engine *EngineImpl) postStop() {
+	var wg sync.WaitGroup
+	for _, runable := range engine.runables {
+		if ps, ok := runable.(PostStopper); ok && runable.Enabled() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer logx.Recover(logger)
+				ps.PostStop(context.Background())
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,74 @@
+package bootstrap
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type recordRunable struct {
+	name   string
+	mux    *sync.Mutex
+	events *[]string
+}
+
+func (r *recordRunable) record(event string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	*r.events = append(*r.events, r.name+":"+event)
+}
+
+func (r *recordRunable) Enabled() bool { return true }
+
+func (r *recordRunable) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (r *recordRunable) GracefulStop() { r.record("stop") }
+
+type preStopRunable struct {
+	recordRunable
+}
+
+func (r *preStopRunable) PreStop(ctx context.Context) { r.record("prestop") }
+
+func TestEnginePreStop(t *testing.T) {
+	var mux sync.Mutex
+	var events []string
+	engine := &EngineImpl{runables: []Runable{
+		&recordRunable{name: "server", mux: &mux, events: &events},
+		&preStopRunable{recordRunable{name: "register", mux: &mux, events: &events}},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := engine.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0] != "register:prestop" {
+		t.Errorf("PreStop should be called before GracefulStop, got %v", events)
+	}
+}
+
+type postStopRunable struct {
+	recordRunable
+}
+
+func (r *postStopRunable) PostStop(ctx context.Context) { r.record("poststop") }
+
+func TestEnginePostStop(t *testing.T) {
+	var mux sync.Mutex
+	var events []string
+	engine := &EngineImpl{runables: []Runable{
+		&postStopRunable{recordRunable{name: "tracer", mux: &mux, events: &events}},
+		&recordRunable{name: "server", mux: &mux, events: &events},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := engine.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[2] != "tracer:poststop" {
+		t.Errorf("PostStop should be called after GracefulStop, got %v", events)
+	}
+}
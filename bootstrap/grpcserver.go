@@ -11,6 +11,8 @@ import (
 type GrpcServer struct {
 	addr   string
 	server *grpc.Server
+	// schema 服务注册的endpoint schema，启用TLS时为grpcs://
+	schema string
 }
 
 func (gs *GrpcServer) Init(addr string, server *grpc.Server) {
@@ -18,6 +20,11 @@ func (gs *GrpcServer) Init(addr string, server *grpc.Server) {
 	gs.server = server
 }
 
+// SetSchema 设置服务注册的endpoint schema，默认为grpc://
+func (gs *GrpcServer) SetSchema(schema string) {
+	gs.schema = schema
+}
+
 func (gs *GrpcServer) Enabled() bool {
 	return len(gs.server.GetServiceInfo()) > 0
 }
@@ -28,7 +35,11 @@ func (gs *GrpcServer) BroadCastAddr() string {
 		panic(err)
 	}
 
-	return fmt.Sprintf("grpc://:%s", port)
+	schema := gs.schema
+	if schema == "" {
+		schema = "grpc://"
+	}
+	return fmt.Sprintf("%s:%s", schema, port)
 }
 
 func (gs *GrpcServer) Run(ctx context.Context) error {
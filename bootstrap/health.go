@@ -0,0 +1,166 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type HealthCheckerOption struct {
+	Interval time.Duration `flag:"interval" default:"10s" usage:"刷新grpc健康状态的间隔"`
+	Timeout  time.Duration `flag:"timeout" default:"3s" usage:"单个健康检查的超时时间"`
+}
+
+// HealthChecker 汇总模块注册的健康检查，提供grpc.health.v1服务以及/healthz和/readyz接口
+// engine启动后变为就绪，PreStop时变为未就绪，使负载均衡和服务发现不再路由到当前实例
+type HealthChecker struct {
+	opt    *HealthCheckerOption
+	server *health.Server
+	ready  atomic.Bool
+
+	mux      sync.RWMutex
+	checks   map[string]func(ctx context.Context) error
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewHealthChecker(opt *HealthCheckerOption) (*HealthChecker, error) {
+	hc := &HealthChecker{
+		opt:    opt,
+		server: health.NewServer(),
+		checks: make(map[string]func(ctx context.Context) error),
+		stop:   make(chan struct{}),
+	}
+	hc.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return hc, nil
+}
+
+// AddCheck 添加健康检查，所有检查都通过时服务才是就绪状态
+func (hc *HealthChecker) AddCheck(name string, check func(ctx context.Context) error) {
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+	if _, ok := hc.checks[name]; ok {
+		panic(fmt.Errorf("health check %s already registered", name))
+	}
+	hc.checks[name] = check
+}
+
+// GrpcServer 返回grpc.health.v1服务的实现
+func (hc *HealthChecker) GrpcServer() healthpb.HealthServer {
+	return hc.server
+}
+
+// Check 执行所有健康检查，返回失败的检查
+func (hc *HealthChecker) Check(ctx context.Context) map[string]error {
+	hc.mux.RLock()
+	checks := maps.Clone(hc.checks)
+	hc.mux.RUnlock()
+
+	var wg sync.WaitGroup
+	var errMux sync.Mutex
+	errs := make(map[string]error)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, hc.opt.Timeout)
+			defer cancel()
+			if err := check(ctx); err != nil {
+				errMux.Lock()
+				errs[name] = err
+				errMux.Unlock()
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Ready 是否就绪：engine已启动、没有在退出过程中、并且所有健康检查都通过
+func (hc *HealthChecker) Ready(ctx context.Context) (bool, map[string]error) {
+	if !hc.ready.Load() {
+		return false, nil
+	}
+	errs := hc.Check(ctx)
+	return len(errs) == 0, errs
+}
+
+// ServeHTTP 处理 /healthz 和 /readyz，其他路径返回404
+func (hc *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	case "/readyz":
+		ready, errs := hc.Ready(r.Context())
+		checks := make(map[string]string, len(errs))
+		for name, err := range errs {
+			checks[name] = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ready": ready, "failed": checks})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// IsHealthPath 是否是健康检查的路径
+func IsHealthPath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
+
+func (hc *HealthChecker) Enabled() bool {
+	return true
+}
+
+// Run 标记为就绪，并定期根据健康检查结果刷新grpc健康状态
+func (hc *HealthChecker) Run(ctx context.Context) error {
+	hc.ready.Store(true)
+	hc.refresh(ctx)
+	ticker := time.NewTicker(hc.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hc.stop:
+			return nil
+		case <-ticker.C:
+			hc.refresh(ctx)
+		}
+	}
+}
+
+func (hc *HealthChecker) refresh(ctx context.Context) {
+	if !hc.ready.Load() {
+		return
+	}
+	status := healthpb.HealthCheckResponse_SERVING
+	if errs := hc.Check(ctx); len(errs) > 0 {
+		logger.Warn("health check failed", "errors", errs)
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hc.server.SetServingStatus("", status)
+}
+
+// PreStop 退出时立即变为未就绪
+func (hc *HealthChecker) PreStop(_ context.Context) {
+	hc.ready.Store(false)
+	hc.server.Shutdown()
+	logger.Info("readiness set to false")
+}
+
+func (hc *HealthChecker) GracefulStop() {
+	hc.stopOnce.Do(func() { close(hc.stop) })
+}
@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthChecker(t *testing.T) {
+	hc, _ := NewHealthChecker(&HealthCheckerOption{Interval: time.Hour, Timeout: time.Second})
+	var dbErr error
+	hc.AddCheck("db", func(ctx context.Context) error { return dbErr })
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		hc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	grpcStatus := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := hc.GrpcServer().Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("should not be ready before run, got %d", code)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hc.Run(ctx)
+	time.Sleep(20 * time.Millisecond)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("should be ready after run, got %d", code)
+	}
+	if s := grpcStatus(); s != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected grpc status %s", s)
+	}
+
+	dbErr = errors.New("connection refused")
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("should not be ready when check failed, got %d", code)
+	}
+	dbErr = nil
+
+	hc.PreStop(context.Background())
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("should not be ready after PreStop, got %d", code)
+	}
+	if s := grpcStatus(); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("unexpected grpc status after PreStop %s", s)
+	}
+}
+
+func TestHealthCheckerGracefulStopTwice(t *testing.T) {
+	hc, _ := NewHealthChecker(&HealthCheckerOption{Interval: time.Hour, Timeout: time.Second})
+	hc.GracefulStop()
+	hc.GracefulStop()
+}
@@ -18,13 +18,19 @@ type HttpServer struct {
 	server  http.Server
 }
 
-func NewHttpServer(ctx context.Context, opt *HttpServerRunOption, handler http.Handler) (*HttpServer, error) {
+func NewHttpServer(ctx context.Context, opt *HttpServerRunOption, handler http.Handler, hc *HealthChecker) (*HttpServer, error) {
 	return &HttpServer{
 		addr:    opt.Addr,
 		handler: handler,
 		server: http.Server{
-			Addr:    opt.Addr,
-			Handler: handler,
+			Addr: opt.Addr,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if IsHealthPath(r.URL.Path) {
+					hc.ServeHTTP(w, r)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			}),
 			BaseContext: func(net.Listener) context.Context {
 				return ctx
 			},
@@ -62,6 +68,6 @@ func (gs *HttpServer) GracefulStop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := gs.server.Shutdown(ctx); err != nil {
-		logger.Error("http server shutdown error: %v", err)
+		logger.Error("http server shutdown error", "error", err)
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/daemtri/begonia/bootstrap/header"
 	"github.com/daemtri/begonia/grpcx"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type LogicServerRunOption struct {
@@ -24,15 +25,17 @@ type LogicServer struct {
 	reg *ServiceRegistrar
 	ci  *ContextInjector
 	bs  *BusinessService
+	hc  *HealthChecker
 }
 
-func NewLogicServer(opt *LogicServerRunOption, sb *grpcx.ServerBuilder, reg *ServiceRegistrar, bs *BusinessService, ci *ContextInjector) (*LogicServer, error) {
+func NewLogicServer(opt *LogicServerRunOption, sb *grpcx.ServerBuilder, reg *ServiceRegistrar, bs *BusinessService, ci *ContextInjector, hc *HealthChecker) (*LogicServer, error) {
 	ls := &LogicServer{
 		opt: opt,
 		sb:  sb,
 		ci:  ci,
 		bs:  bs,
 		reg: reg,
+		hc:  hc,
 	}
 	return ls, ls.init()
 }
@@ -47,12 +50,15 @@ func (ls *LogicServer) init() error {
 	}
 	ls.reg.RegisterTo(server)
 	ls.GrpcServer.Init(ls.opt.Addr, server)
+	ls.GrpcServer.SetSchema(ls.sb.Schema())
 	transmit.RegisterBusinessServiceServer(ls.server, ls.bs)
+	healthpb.RegisterHealthServer(ls.server, ls.hc.GrpcServer())
 	return nil
 }
 
+// Enabled 除了内置的BusinessService和健康检查服务外，还注册了其他服务或者路由时启用
 func (ls *LogicServer) Enabled() bool {
-	return len(ls.GrpcServer.server.GetServiceInfo()) > 1 || len(ls.reg.services) > 0
+	return len(ls.GrpcServer.server.GetServiceInfo()) > 2 || len(ls.reg.services) > 0
 }
 
 type ContextInjector struct {
@@ -3,26 +3,77 @@ package bootstrap
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/daemtri/begonia/contract"
 )
 
+type route struct {
+	info    contract.RouteInfo
+	handler contract.RouteHandler
+}
+
 // RouteRegistrar 路由注册表
+// 拦截器分为全局拦截器和模块拦截器，全局拦截器在外层，模块拦截器只作用于该模块注册的路由
 type RouteRegistrar struct {
-	routes map[int32]func(ctx context.Context, req []byte) error
+	routes             map[int32]*route
+	interceptors       []contract.RouteInterceptor
+	moduleInterceptors map[string][]contract.RouteInterceptor
+
+	buildOnce sync.Once
+	handlers  map[int32]contract.RouteHandler
 }
 
 func NewRouteRegistrar() (*RouteRegistrar, error) {
 	return &RouteRegistrar{
-		routes: make(map[int32]func(ctx context.Context, req []byte) error),
+		routes:             make(map[int32]*route),
+		moduleInterceptors: make(map[string][]contract.RouteInterceptor),
 	}, nil
 }
 
 func (rr *RouteRegistrar) RegisterRoute(routes ...contract.RouteCell) {
-	for _, route := range routes {
-		if _, ok := rr.routes[route.MsgID]; ok {
-			panic(fmt.Errorf("route %d already registered", route.MsgID))
+	for _, r := range routes {
+		if _, ok := rr.routes[r.MsgID]; ok {
+			panic(fmt.Errorf("route %d already registered", r.MsgID))
+		}
+		rr.routes[r.MsgID] = &route{
+			info:    contract.RouteInfo{MsgID: r.MsgID, Module: r.Module},
+			handler: r.HandleFunc,
+		}
+	}
+}
+
+// Use 添加全局路由拦截器，必须在服务启动前调用
+func (rr *RouteRegistrar) Use(interceptors ...contract.RouteInterceptor) {
+	rr.interceptors = append(rr.interceptors, interceptors...)
+}
+
+// UseModule 添加模块路由拦截器，必须在服务启动前调用
+func (rr *RouteRegistrar) UseModule(module string, interceptors ...contract.RouteInterceptor) {
+	rr.moduleInterceptors[module] = append(rr.moduleInterceptors[module], interceptors...)
+}
+
+// lookup 查找msgid对应的处理函数，第一次调用时构建所有路由的拦截器链
+func (rr *RouteRegistrar) lookup(msgID int32) (contract.RouteHandler, bool) {
+	rr.buildOnce.Do(rr.build)
+	h, ok := rr.handlers[msgID]
+	return h, ok
+}
+
+func (rr *RouteRegistrar) build() {
+	rr.handlers = make(map[int32]contract.RouteHandler, len(rr.routes))
+	for msgID, r := range rr.routes {
+		interceptors := make([]contract.RouteInterceptor, 0, len(rr.interceptors)+len(rr.moduleInterceptors[r.info.Module]))
+		interceptors = append(interceptors, rr.interceptors...)
+		interceptors = append(interceptors, rr.moduleInterceptors[r.info.Module]...)
+		chain := contract.ChainRouteInterceptors(interceptors...)
+		if chain == nil {
+			rr.handlers[msgID] = r.handler
+			continue
+		}
+		info, handler := r.info, r.handler
+		rr.handlers[msgID] = func(ctx context.Context, req []byte) ([]byte, error) {
+			return chain(ctx, req, &info, handler)
 		}
-		rr.routes[route.MsgID] = route.HandleFunc
 	}
 }
@@ -2,21 +2,80 @@ package contract
 
 import "context"
 
-// RouteCell please use app.Route(msgid,handleFunc)
+// RouteCell please use app.Route(msgid,handleFunc) or app.RouteReply(msgid,handleFunc)
+// HandleFunc 返回的数据会作为 DispatchReply.Data 返回给调用方, 无响应时返回nil
+// 迁移: 手动构造RouteCell的代码需要把 func(ctx, req) error 改为返回 (nil, err)，使用app.Route注册的路由不需要修改
 type RouteCell struct {
 	MsgID      int32
-	HandleFunc func(ctx context.Context, req []byte) error
+	HandleFunc func(ctx context.Context, req []byte) ([]byte, error)
+	// Module 路由所属模块，通过app注册时自动填充，用于选择模块级拦截器
+	Module string
 }
 
 type RouteRegistrar interface {
 	RegisterRoute(routes ...RouteCell)
 }
 
+// RouteInfo 路由信息，拦截器可以通过它获取当前请求的msgid和所属模块
+type RouteInfo struct {
+	MsgID  int32
+	Module string
+}
+
+// RouteHandler 路由处理函数
+type RouteHandler func(ctx context.Context, req []byte) ([]byte, error)
+
+// RouteInterceptor 路由拦截器，与grpc.UnaryServerInterceptor类似，按msgid而不是方法名区分
+type RouteInterceptor func(ctx context.Context, req []byte, info *RouteInfo, handler RouteHandler) ([]byte, error)
+
+// ChainRouteInterceptors 将多个拦截器串联为一个，第一个拦截器在最外层
+func ChainRouteInterceptors(interceptors ...RouteInterceptor) RouteInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(ctx context.Context, req []byte, info *RouteInfo, handler RouteHandler) ([]byte, error) {
+		return interceptors[0](ctx, req, info, chainRouteHandler(interceptors, 0, info, handler))
+	}
+}
+
+func chainRouteHandler(interceptors []RouteInterceptor, curr int, info *RouteInfo, final RouteHandler) RouteHandler {
+	if curr == len(interceptors)-1 {
+		return final
+	}
+	return func(ctx context.Context, req []byte) ([]byte, error) {
+		return interceptors[curr+1](ctx, req, info, chainRouteHandler(interceptors, curr+1, info, final))
+	}
+}
+
 // TaskProcessorRegistrar
 type TaskProcessorRegistrar interface {
 	ProcessTask(taskType string, handle func(context.Context, *Task) error)
 }
 
+// PubSubConsumerRegistrar 消息订阅注册
+// handle 的形式为 func(context.Context, T) error，T 可以是 pubsub.Message、[]byte 或者 proto.Message
 type PubSubConsumerRegistrar interface {
-	SubscribeTopic(topic string, handle any)
+	SubscribeTopic(topic string, handle any, opts ...SubscribeOption)
+}
+
+type SubscribeOptions struct {
+	// Concurrency 同一个topic同时运行的消费者数量，0表示使用默认配置
+	Concurrency int
+}
+
+type SubscribeOption func(*SubscribeOptions)
+
+// WithConcurrency 设置topic的消费者数量
+func WithConcurrency(n int) SubscribeOption {
+	return func(so *SubscribeOptions) {
+		so.Concurrency = n
+	}
+}
+
+// HealthCheckRegistrar 健康检查注册，所有检查都通过时服务才是就绪状态
+type HealthCheckRegistrar interface {
+	AddCheck(name string, check func(ctx context.Context) error)
 }
@@ -9,14 +9,24 @@ import (
 )
 
 type Task struct {
-	typename   string
-	payload    []byte
+	typename string
+	payload  []byte
+	// ID 任务ID，使用 schedule.WithKey 添加的任务ID即为该key
+	ID string
+	// Retried 任务已经重试的次数
+	Retried    int
 	ScheduleAt time.Time
 }
 
+func NewTask(typename string, payload []byte) *Task {
+	return &Task{typename: typename, payload: payload}
+}
+
 func (t *Task) Type() string    { return t.typename }
 func (t *Task) Payload() []byte { return t.payload }
 
+// Deprecated: app.GetScheduler 返回 schedule.Scheduler，AddTask 增加了ctx、任务类型和 schedule.TaskOption 参数，
+// 迁移时把 AddTask(task) 改为 AddTask(ctx, task.Type(), task.Payload(), schedule.WithScheduleAt(task.ScheduleAt))
 type Scheduler interface {
 	AddTask(task *Task) error
 }
@@ -51,3 +61,22 @@ type UserInfoInterface interface {
 	GetGameID() uint32
 	GetVersion() uint32
 }
+
+// LeaderCallbacks 领导选举回调
+type LeaderCallbacks struct {
+	// OnElected 成为leader后调用，ctx在失去leader时取消，fence为单调递增的fencing token
+	// OnElected 可以一直阻塞到ctx取消，也可以启动任务后立即返回
+	OnElected func(ctx context.Context, fence int64)
+	// OnRevoked 失去leader并且OnElected返回后调用，此后会重新参与选举
+	OnRevoked func(ctx context.Context)
+}
+
+// Leadership 一次选举的状态，同一服务的所有实例中同时只有一个实例是leader
+type Leadership interface {
+	// IsLeader 当前实例是否是leader
+	IsLeader() bool
+	// Fence 最近一次成为leader时获得的fencing token
+	Fence() int64
+	// Resign 放弃leader并退出选举
+	Resign(ctx context.Context) error
+}
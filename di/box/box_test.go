@@ -0,0 +1,103 @@
+package box
+
+import (
+	"context"
+	"testing"
+)
+
+// testLoader 保存setter，模拟配置变更
+type testLoader struct {
+	setter func([]ConfigItem)
+}
+
+func (l *testLoader) Load(ctx context.Context, setter func([]ConfigItem)) error {
+	l.setter = setter
+	return nil
+}
+
+type testFactory struct {
+	Addr string `flag:"addr" default:"localhost" usage:"地址"`
+
+	retrofits int
+}
+
+func (f *testFactory) Retrofit() error {
+	f.retrofits++
+	return nil
+}
+
+type testOptions struct {
+	Name string `flag:"name" default:"a" usage:"名称"`
+
+	retrofits int
+}
+
+func (o *testOptions) Retrofit() error {
+	o.retrofits++
+	return nil
+}
+
+type testLevel struct {
+	level int
+}
+
+type testLevelBuilder struct {
+	Level int `flag:"level" default:"1" usage:"等级"`
+
+	retrofits int
+}
+
+func (b *testLevelBuilder) Build(ctx context.Context) (*testLevel, error) {
+	return &testLevel{level: b.Level}, nil
+}
+
+func (b *testLevelBuilder) Retrofit() error {
+	b.retrofits++
+	return nil
+}
+
+type testService struct {
+	opts    *testOptions
+	factory *testFactory
+	level   *testLevel
+}
+
+func TestSetConfigRetrofit(t *testing.T) {
+	factory := &testFactory{}
+	levelBuilder := &testLevelBuilder{}
+	Provide[*testFactory](factory, WithFlags("factory"))
+	Provide[*testLevel](levelBuilder, WithFlags("level"))
+	Provide[*testService](func(opts *testOptions, f *testFactory, l *testLevel) (*testService, error) {
+		return &testService{opts: opts, factory: f, level: l}, nil
+	}, WithFlags("service"))
+
+	initialized := false
+	UseInit(func(ctx context.Context) error {
+		initialized = true
+		return nil
+	})
+
+	loader := &testLoader{}
+	svc, err := Build[*testService](context.Background(), UseConfigLoader("test", loader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !initialized {
+		t.Fatal("init function not called")
+	}
+	if svc.factory.Addr != "localhost" || svc.opts.Name != "a" || svc.level.level != 1 {
+		t.Fatalf("default flags not bound: addr=%q name=%q level=%d", svc.factory.Addr, svc.opts.Name, svc.level.level)
+	}
+
+	loader.setter([]ConfigItem{
+		{Key: "factory-addr", Value: "remote"},
+		{Key: "service-name", Value: "b"},
+		{Key: "level-level", Value: "2"},
+	})
+	if factory.Addr != "remote" || svc.opts.Name != "b" || levelBuilder.Level != 2 {
+		t.Fatalf("config not set: addr=%q name=%q level=%d", factory.Addr, svc.opts.Name, levelBuilder.Level)
+	}
+	if factory.retrofits != 1 || svc.opts.retrofits != 1 || levelBuilder.retrofits != 1 {
+		t.Fatalf("retrofit not forwarded: instance=%d option=%d builder=%d", factory.retrofits, svc.opts.retrofits, levelBuilder.retrofits)
+	}
+}
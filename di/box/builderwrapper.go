@@ -154,18 +154,35 @@ func (ib *dynamicParamsFunctionBuilder[T]) Build(ctx context.Context) (T, error)
 	return emptyValue[T](), ret[1].Interface().(error)
 }
 
+// Retrofit 参数实现了Retrofiter时，配置变更后触发参数的Retrofit
+func (ib *dynamicParamsFunctionBuilder[T]) Retrofit() error {
+	if r, ok := ib.Option.(Retrofiter); ok {
+		return r.Retrofit()
+	}
+	return nil
+}
+
+// instanceBuilder 直接提供实例，实例的flag字段会被绑定
 type instanceBuilder[T any] struct {
-	instance T
+	Instance T `flag:""`
 }
 
 func newInstanceBuilder[T any](instance T) Builder[T] {
 	return &instanceBuilder[T]{
-		instance: instance,
+		Instance: instance,
 	}
 }
 
 func (ib *instanceBuilder[T]) Build(ctx context.Context) (T, error) {
-	return ib.instance, nil
+	return ib.Instance, nil
+}
+
+// Retrofit 实例实现了Retrofiter时，配置变更后触发实例的Retrofit
+func (ib *instanceBuilder[T]) Retrofit() error {
+	if r, ok := any(ib.Instance).(Retrofiter); ok {
+		return r.Retrofit()
+	}
+	return nil
 }
 
 type validateAbleBuilder[T any] struct {
@@ -181,3 +198,11 @@ func newValidateAbleBuilder[T any](builder Builder[T]) Builder[T] {
 func (wb *validateAbleBuilder[T]) ValidateFlags() error {
 	return validate.Struct(wb.Builder)
 }
+
+// Retrofit 转发给被包装的builder
+func (wb *validateAbleBuilder[T]) Retrofit() error {
+	if r, ok := wb.Builder.(Retrofiter); ok {
+		return r.Retrofit()
+	}
+	return nil
+}
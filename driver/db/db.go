@@ -1,16 +1,22 @@
 package db
 
 import (
+	"github.com/daemtri/begonia/metrics"
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 type Options struct {
 	DriverName string `flag:"driver_name" default:"mysql" usage:"驱动"`
 	DSN        string `flag:"dsn" default:"" usage:"连接地址"`
+	// Name 监控指标中的db_name，为空时使用DriverName
+	Name string
 }
 
 type Database struct {
 	*sqlx.DB
+	// unregister 注销连接池指标
+	unregister func()
 }
 
 func NewDB(opt *Options) (*Database, error) {
@@ -18,7 +24,19 @@ func NewDB(opt *Options) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	name := opt.Name
+	if name == "" {
+		name = opt.DriverName
+	}
 	return &Database{
 		DB: db,
+		// 连接池状态，指标名称为go_sql_*
+		unregister: metrics.RegisterInstance(collectors.NewDBStatsCollector(db.DB, name)),
 	}, nil
 }
+
+// Close 注销监控指标并关闭连接池
+func (db *Database) Close() error {
+	db.unregister()
+	return db.DB.Close()
+}
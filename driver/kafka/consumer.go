@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/segmentio/kafka-go"
@@ -14,19 +15,46 @@ type Consumer struct {
 
 type ConsumerOption struct {
 	Brokers string `flag:"brokers" default:"127.0.0.1:9092" usage:"Kafka bootstrap Brokers to connect to, as a comma separated list"`
-	Group   string `flag:"group" usage:"消费组"`
+	Group   string `flag:"group" default:"" usage:"消费组，为空时使用服务名"`
 }
 
 func NewConsumer(opt *ConsumerOption) (*Consumer, error) {
+	// kafka-go 在GroupID为空时不能设置GroupTopics，创建Reader会panic
+	if opt.Group == "" {
+		return nil, errors.New("kafka consumer group is required")
+	}
 	return &Consumer{opts: opt}, nil
 }
 
-type Reader = kafka.Reader
+// Reader 包装kafka.Reader，拉取消息时统计消费数和消费延迟
+type Reader struct {
+	*kafka.Reader
+	group string
+}
 
 func (th *Consumer) NewReader(ctx context.Context, topics ...string) *Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     strings.Split(th.opts.Brokers, ","), // Kafka brokers
-		GroupID:     th.opts.Group,
-		GroupTopics: topics,
-	})
+	return &Reader{
+		Reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     strings.Split(th.opts.Brokers, ","), // Kafka brokers
+			GroupID:     th.opts.Group,
+			GroupTopics: topics,
+		}),
+		group: th.opts.Group,
+	}
+}
+
+func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
+	msg, err := r.Reader.FetchMessage(ctx)
+	if err == nil {
+		observeFetch(r.group, &msg)
+	}
+	return msg, err
+}
+
+func (r *Reader) ReadMessage(ctx context.Context) (Message, error) {
+	msg, err := r.Reader.ReadMessage(ctx)
+	if err == nil {
+		observeFetch(r.group, &msg)
+	}
+	return msg, err
 }
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/daemtri/begonia/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	producerMessages = metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "kafka_producer",
+		Name:      "messages_total",
+		Help:      "kafka发送的消息数",
+	}, []string{"topic", "result"}))
+	producerWriteSeconds = metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "kafka_producer",
+		Name:      "write_seconds",
+		Help:      "kafka发送消息的耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"}))
+	consumerMessages = metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "kafka_consumer",
+		Name:      "messages_total",
+		Help:      "kafka消费的消息数",
+	}, []string{"group", "topic"}))
+	consumerLag = metrics.Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "kafka_consumer",
+		Name:      "lag",
+		Help:      "kafka消费延迟，最后一次拉取的消息与分区最新消息之间的消息数",
+	}, []string{"group", "topic", "partition"}))
+)
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+func observeWrite(msgs []Message, start time.Time, err error) {
+	res := result(err)
+	producerWriteSeconds.WithLabelValues(res).Observe(time.Since(start).Seconds())
+	for i := range msgs {
+		producerMessages.WithLabelValues(msgs[i].Topic, res).Inc()
+	}
+}
+
+func observeFetch(group string, msg *Message) {
+	consumerMessages.WithLabelValues(group, msg.Topic).Inc()
+	// HighWaterMark是分区下一条消息的offset
+	lag := msg.HighWaterMark - msg.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	consumerLag.WithLabelValues(group, msg.Topic, strconv.Itoa(msg.Partition)).Set(float64(lag))
+}
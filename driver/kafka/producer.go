@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -26,6 +27,11 @@ func NewProducer(opt *ProducerOption) (*Producer, error) {
 
 type Message = kafka.Message
 
+type Header = kafka.Header
+
 func (th *Producer) WriteMessage(ctx context.Context, msgs ...Message) error {
-	return th.writer.WriteMessages(ctx, msgs...)
+	start := time.Now()
+	err := th.writer.WriteMessages(ctx, msgs...)
+	observeWrite(msgs, start, err)
+	return err
 }
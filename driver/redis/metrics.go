@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daemtri/begonia/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	commandDuration = metrics.Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "redis",
+		Name:      "command_seconds",
+		Help:      "redis命令耗时，pipeline按pipeline统计",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"addr", "command"}))
+	commandErrors = metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "redis",
+		Name:      "command_errors_total",
+		Help:      "redis命令错误数，不包括redis.Nil",
+	}, []string{"addr", "command"}))
+)
+
+// metricsHook 统计redis命令的耗时和错误
+type metricsHook struct {
+	addr string
+}
+
+func (h metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h metricsHook) observe(command string, start time.Time, err error) {
+	commandDuration.WithLabelValues(h.addr, command).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		commandErrors.WithLabelValues(h.addr, command).Inc()
+	}
+}
+
+func (h metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.observe(strings.ToLower(cmd.Name()), start, err)
+		return err
+	}
+}
+
+func (h metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.observe("pipeline", start, err)
+		return err
+	}
+}
+
+// poolStatsCollector 采集连接池状态
+type poolStatsCollector struct {
+	client *redis.Client
+
+	hits, misses, timeouts, total, idle, stale *prometheus.Desc
+}
+
+func newPoolStatsCollector(client *redis.Client, addr string, db int) *poolStatsCollector {
+	labels := prometheus.Labels{"addr": addr, "db": strconv.Itoa(db)}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "redis_pool", name), help, nil, labels)
+	}
+	return &poolStatsCollector{
+		client:   client,
+		hits:     desc("hits_total", "连接池命中次数"),
+		misses:   desc("misses_total", "连接池未命中次数"),
+		timeouts: desc("timeouts_total", "等待连接超时次数"),
+		total:    desc("connections", "连接总数"),
+		idle:     desc("idle_connections", "空闲连接数"),
+		stale:    desc("stale_connections_total", "被移除的过期连接数"),
+	}
+}
+
+func (c *poolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.total
+	ch <- c.idle
+	ch <- c.stale
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(stats.StaleConns))
+}
+
+// instrument 为客户端添加监控指标，返回注销连接池指标的函数
+func instrument(client *redis.Client) func() {
+	opts := client.Options()
+	client.AddHook(metricsHook{addr: opts.Addr})
+	return metrics.RegisterInstance(newPoolStatsCollector(client, opts.Addr, opts.DB))
+}
+
+var _ redis.Hook = metricsHook{}
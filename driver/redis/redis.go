@@ -38,6 +38,8 @@ type Redis struct {
 	hashSafelyDecrString                string
 	cmpSetScriptHash                    string
 	maxWithSocresCheckExpiredScriptHash string
+	// unregister 注销连接池指标
+	unregister func()
 }
 
 func NewRedis(_ context.Context, option *Options) (*Redis, error) {
@@ -52,12 +54,17 @@ func NewRedis(_ context.Context, option *Options) (*Redis, error) {
 	if option.DisableDelayCmd {
 		client.AddHook(disableCmd{largeKeyLen: option.LargeKeyLen})
 	}
-
-	return &Redis{Client: client}, nil
+	return &Redis{Client: client, unregister: instrument(client)}, nil
 }
 
 func FromClient(client *redis.Client) (*Redis, error) {
-	return &Redis{Client: client}, nil
+	return &Redis{Client: client, unregister: instrument(client)}, nil
+}
+
+// Close 注销监控指标并关闭客户端
+func (redis *Redis) Close() error {
+	redis.unregister()
+	return redis.Client.Close()
 }
 
 const hashSafelyDecrScript = `
@@ -11,17 +11,19 @@ import (
 	"github.com/daemtri/begonia/grpcx/grpclogx"
 	"github.com/daemtri/begonia/grpcx/grpcoptions"
 	"github.com/daemtri/begonia/grpcx/grpcresolver"
+	"github.com/daemtri/begonia/grpcx/grpctls"
+	"github.com/daemtri/begonia/grpcx/resilience"
 	"github.com/daemtri/begonia/grpcx/tracing"
 	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/metrics"
 	"github.com/daemtri/begonia/runtime/component"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/status"
 )
@@ -62,6 +64,8 @@ type ServerOptions struct {
 	InitialWindowSize     int  `flag:"initial_window_size" default:"1048576" usage:""`      //  1 * 1024 * 1024
 	InitialConnWindowSize int  `flag:"initial_conn_window_size" default:"1048576" usage:""` //  1 * 1024 * 1024
 	MaxConcurrentStreams  uint `flag:"max_concurrent_streams" default:"10000" usage:""`
+
+	TLS grpctls.Options `flag:"tls"`
 }
 
 type ServerBuilder struct {
@@ -73,14 +77,20 @@ func NewServerBuilder(opts *ServerOptions, tb *tracing.Factory) (*ServerBuilder,
 	return &ServerBuilder{opts: opts, tb: tb}, nil
 }
 
+// Schema 服务注册使用的endpoint schema，启用TLS时为grpcs://
+func (sb *ServerBuilder) Schema() string {
+	return sb.opts.TLS.Schema()
+}
+
 func (sb *ServerBuilder) NewGrpcServer(streamInterceptors []grpc.StreamServerInterceptor, unaryInterceptors []grpc.UnaryServerInterceptor) (*grpc.Server, error) {
-	tp, err := sb.tb.NewTracerProvider(attribute.String("sgr.kind", "runtime-server"))
+	tp, err := sb.tb.TracerProvider("runtime-server")
 	if err != nil {
 		return nil, err
 	}
 	streamInterceptors = append(
 		streamInterceptors,
 		grpc_ctxtags.StreamServerInterceptor(),
+		metrics.StreamServerInterceptor,
 		// grpc_zap.StreamServerInterceptor(zapLogger),
 		otelgrpc.StreamServerInterceptor(
 			otelgrpc.WithTracerProvider(tp),
@@ -92,6 +102,7 @@ func (sb *ServerBuilder) NewGrpcServer(streamInterceptors []grpc.StreamServerInt
 	unaryInterceptors = append(
 		unaryInterceptors,
 		grpc_ctxtags.UnaryServerInterceptor(),
+		metrics.UnaryServerInterceptor,
 		// grpc_zap.UnaryServerInterceptor(zapLogger),
 		otelgrpc.UnaryServerInterceptor(
 			otelgrpc.WithTracerProvider(tp),
@@ -100,7 +111,12 @@ func (sb *ServerBuilder) NewGrpcServer(streamInterceptors []grpc.StreamServerInt
 		grpc_recovery.UnaryServerInterceptor(),
 	)
 
+	creds, err := sb.opts.TLS.ServerCredentials()
+	if err != nil {
+		return nil, err
+	}
 	opts := []grpc.ServerOption{
+		grpc.Creds(creds),
 		// 大文件支持
 		grpc.MaxSendMsgSize(sb.opts.MaxSendMsgSize),
 		grpc.MaxRecvMsgSize(sb.opts.MaxRecvMsgSize),
@@ -121,20 +137,65 @@ type ClientOptions struct {
 	MaxRecvMsgSize        int `flag:"max_recv_msg_size" default:"4194304" usage:""`        //  4 * 1024 * 1024
 	InitialWindowSize     int `flag:"initial_window_size" default:"1048576" usage:""`      //  1 * 1024 * 1024
 	InitialConnWindowSize int `flag:"initial_conn_window_size" default:"1048576" usage:""` //  1 * 1024 * 1024
+
+	ResolveTimeout time.Duration `flag:"resolve_timeout" default:"5s" usage:"等待第一次服务发现结果的超时时间，超时后使用快照并在后台重试"`
+	SnapshotDir    string        `flag:"snapshot_dir" default:"" usage:"服务发现快照目录，服务发现不可用时使用最后一次成功的结果，为空时不保存快照"`
+
+	TLS        grpctls.Options    `flag:"tls"`
+	Resilience resilience.Options `flag:"resilience"`
+}
+
+// Retrofit 配置变更后更新容错策略
+func (o *ClientOptions) Retrofit() error {
+	return o.Resilience.Retrofit()
 }
 
 type ClientBuilder struct {
 	opts         *ClientOptions
 	traceFactory *tracing.Factory
+	creds        credentials.TransportCredentials
+	resolver     grpcresolver.Builder
 }
 
 func NewClientBuilder(opts *ClientOptions, tb *tracing.Factory, discovery component.Discovery) (*ClientBuilder, error) {
-	grpcresolver.RegisterInCluster("relay", discovery)
-	return &ClientBuilder{opts: opts, traceFactory: tb}, nil
+	creds, err := opts.TLS.ClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Resilience.Retrofit(); err != nil {
+		return nil, err
+	}
+	// 拨号时使用同一个resolver builder，灰度策略只在当前ClientBuilder创建的连接之间共享
+	rb := grpcresolver.RegisterInCluster("relay", discovery,
+		grpcresolver.WithInitTimeout(opts.ResolveTimeout),
+		grpcresolver.WithSnapshotDir(opts.SnapshotDir),
+	)
+	return &ClientBuilder{opts: opts, traceFactory: tb, creds: creds, resolver: rb}, nil
 }
 
+// Schema 服务发现使用的endpoint schema，启用TLS时只连接grpcs://的endpoint
+func (cb *ClientBuilder) Schema() string {
+	return cb.opts.TLS.Schema()
+}
+
+// NewGrpcClientConn 创建服务的客户端连接，服务配置了灰度发布策略时按请求路由到对应分组的连接
 func (cb *ClientBuilder) NewGrpcClientConn(serviceName string, schema string, defaultServiceConfig string) (grpc.ClientConnInterface, error) {
-	tp, err := cb.traceFactory.NewTracerProvider(attribute.String("sgr.kind", "relay-client"))
+	conn, err := cb.dial(serviceName, schema, "", defaultServiceConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &grayReleaseClientConn{
+		ClientConnInterface: conn,
+		serviceName:         serviceName,
+		policies:            cb.resolver,
+		dial: func(group string) (grayReleaseConn, error) {
+			return cb.dial(serviceName, schema, group, defaultServiceConfig)
+		},
+	}, nil
+}
+
+func (cb *ClientBuilder) dial(serviceName, schema, group, defaultServiceConfig string) (*grpc.ClientConn, error) {
+	tp, err := cb.traceFactory.TracerProvider("relay-client")
 	if err != nil {
 		return nil, err
 	}
@@ -151,13 +212,19 @@ func (cb *ClientBuilder) NewGrpcClientConn(serviceName string, schema string, de
 	target.WriteString("")
 	target.WriteString("?schema=")
 	target.WriteString(url.QueryEscape(schema))
-	ctx, cancel := context.WithTimeout(context.TODO(), grpcTimeoutDefault*time.Second)
+	if group != "" {
+		target.WriteString("&group=")
+		target.WriteString(url.QueryEscape(group))
+	}
+	// resolver初始化时最多等待ResolveTimeout，拨号超时需要大于它
+	ctx, cancel := context.WithTimeout(context.TODO(), cb.opts.ResolveTimeout+grpcTimeoutDefault*time.Second)
 	defer cancel()
 	conn, err := grpc.DialContext(ctx,
 		target.String(),
 		// 设置默认负载均衡调度算法为轮询
 		// see https://github.com/grpc/grpc/blob/master/doc/service_config.md
 		grpc.WithDefaultServiceConfig(defaultServiceConfig),
+		grpc.WithResolvers(cb.resolver),
 		// 优化GRPC吞吐量
 		grpc.WithInitialWindowSize(int32(cb.opts.InitialWindowSize)),
 		grpc.WithInitialConnWindowSize(int32(cb.opts.InitialConnWindowSize)),
@@ -166,16 +233,18 @@ func (cb *ClientBuilder) NewGrpcClientConn(serviceName string, schema string, de
 			grpc.MaxCallSendMsgSize(cb.opts.MaxSendMsgSize),
 			grpc.MaxCallRecvMsgSize(cb.opts.MaxRecvMsgSize),
 		),
-		// 暂时不支持加密连接
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		// 调用链追踪
+		grpc.WithTransportCredentials(cb.creds),
+		// 容错策略和调用链追踪，重试和对冲的每次请求单独统计
 		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+			cb.opts.Resilience.UnaryClientInterceptor(serviceName),
+			metrics.UnaryClientInterceptor,
 			otelgrpc.UnaryClientInterceptor(
 				otelgrpc.WithTracerProvider(tp),
 				otelgrpc.WithInterceptorFilter(nil),
 			),
 		)),
 		grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
+			metrics.StreamClientInterceptor,
 			otelgrpc.StreamClientInterceptor(
 				otelgrpc.WithTracerProvider(tp),
 				otelgrpc.WithInterceptorFilter(nil),
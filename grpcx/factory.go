@@ -18,10 +18,8 @@ import (
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 
 	_ "github.com/daemtri/begonia/grpcx/balancer"
@@ -39,11 +37,16 @@ type Factory struct {
 
 // RuntimeServer 接收来自APP的调用和GRPC代理请求
 func (f *Factory) RuntimeServer(ush grpc.StreamHandler, addOpts ...grpc.ServerOption) (*grpc.Server, error) {
-	tp, err := f.traceFactory.NewTracerProvider(attribute.String("sgr.kind", "runtime-server"))
+	tp, err := f.traceFactory.TracerProvider("runtime-server")
+	if err != nil {
+		return nil, err
+	}
+	creds, err := f.options.ServerTLS.ServerCredentials()
 	if err != nil {
 		return nil, err
 	}
 	opts := []grpc.ServerOption{
+		grpc.Creds(creds),
 		// 大文件支持
 		grpc.MaxSendMsgSize(f.options.MaxSendMsgSize),
 		grpc.MaxRecvMsgSize(f.options.MaxRecvMsgSize),
@@ -82,13 +85,17 @@ func (f *Factory) RuntimeServer(ush grpc.StreamHandler, addOpts ...grpc.ServerOp
 
 // RelayClient 转发 RuntimeServer 收到的请求，调用RelayServer
 func (f *Factory) RelayClient(serviceName, schema string, defaultServiceConfig string) (*grpc.ClientConn, error) {
-	tp, err := f.traceFactory.NewTracerProvider(attribute.String("sgr.kind", "relay-client"))
+	tp, err := f.traceFactory.TracerProvider("relay-client")
 	if err != nil {
 		return nil, err
 	}
 	if conn, ok := f.ConnsMap.Load(serviceName); ok {
 		return conn, nil
 	}
+	creds, err := f.options.ClientTLS.ClientCredentials()
+	if err != nil {
+		return nil, err
+	}
 	if defaultServiceConfig == "" {
 		defaultServiceConfig = `{"loadBalancingConfig": [{"round_robin":{}}]}`
 	}
@@ -116,8 +123,7 @@ func (f *Factory) RelayClient(serviceName, schema string, defaultServiceConfig s
 			grpc.MaxCallSendMsgSize(f.options.MaxSendMsgSize),
 			grpc.MaxCallRecvMsgSize(f.options.MaxRecvMsgSize),
 		),
-		// 暂时不支持加密连接
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		// 调用链追踪
 		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
 			otelgrpc.UnaryClientInterceptor(
@@ -151,13 +157,18 @@ func (f *Factory) RelayServer(appName, appAddr string) (*grpc.Server, error) {
 		return nil, err
 	}
 
-	tpRelayServer, err := f.traceFactory.NewTracerProvider(attribute.String("sgr.kind", "relay-server"))
+	tpRelayServer, err := f.traceFactory.TracerProvider("relay-server")
+	if err != nil {
+		return nil, err
+	}
+	creds, err := f.options.ServerTLS.ServerCredentials()
 	if err != nil {
 		return nil, err
 	}
 	// zapLogger, _ := zap.NewDevelopment()
 	// zapLogger = zapLogger.Named("sgr-relay").WithOptions(zap.AddCallerSkip(2))
 	server := grpc.NewServer(
+		grpc.Creds(creds),
 		// 大文件支持
 		grpc.MaxSendMsgSize(f.options.MaxSendMsgSize),
 		grpc.MaxRecvMsgSize(f.options.MaxRecvMsgSize),
@@ -186,7 +197,11 @@ func (f *Factory) RelayServer(appName, appAddr string) (*grpc.Server, error) {
 
 // AppClient 接收RelayServer收到的请求，转发给APP
 func (f *Factory) AppClient(appName, target string) (*grpc.ClientConn, error) {
-	tp, err := f.traceFactory.NewTracerProvider(attribute.String("sgr.kind", "app-client"))
+	tp, err := f.traceFactory.TracerProvider("app-client")
+	if err != nil {
+		return nil, err
+	}
+	creds, err := f.options.ClientTLS.ClientCredentials()
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +209,7 @@ func (f *Factory) AppClient(appName, target string) (*grpc.ClientConn, error) {
 		grpc.WithInitialWindowSize(1*1024*1024),
 		grpc.WithInitialConnWindowSize(1*1024*1024),
 		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(4*1024*1024), grpc.MaxCallRecvMsgSize(4*1024*1024)),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		grpc.WithContextDialer(dialer),
 		grpc.WithUnaryInterceptor(
 			otelgrpc.UnaryClientInterceptor(
@@ -0,0 +1,85 @@
+package grpcx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/grpcx/grpcresolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/grpclog"
+)
+
+// grayReleaseConnCloseDelay 分组从灰度策略中移除后，等待进行中的请求完成再关闭连接
+var grayReleaseConnCloseDelay = 30 * time.Second
+
+type grayReleaseConn interface {
+	grpc.ClientConnInterface
+	Close() error
+}
+
+// grayReleaseClientConn 根据resolver解析到的灰度策略为每个请求选择灰度分组的连接
+// 每个分组单独拨号，resolver只返回分组内的实例，balancer不需要感知灰度策略
+type grayReleaseClientConn struct {
+	grpc.ClientConnInterface
+	serviceName string
+	policies    grpcresolver.Builder
+	dial        func(group string) (grayReleaseConn, error)
+
+	mux    sync.Mutex
+	policy *grpcresolver.GrayReleasePolicy
+	groups map[string]grayReleaseConn
+}
+
+func (c *grayReleaseClientConn) pick(ctx context.Context) grpc.ClientConnInterface {
+	policy := c.policies.GrayReleasePolicy(c.serviceName)
+	group := ""
+	if policy != nil {
+		group = policy.PickGroup(ctx)
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if policy != c.policy {
+		c.closeStaleGroups(policy)
+		c.policy = policy
+	}
+	if group == "" {
+		return c.ClientConnInterface
+	}
+	if conn, ok := c.groups[group]; ok {
+		return conn
+	}
+	conn, err := c.dial(group)
+	if err != nil {
+		grpclog.Warningf("dial gray release group %s/%s error: %v, use default group", c.serviceName, group, err)
+		return c.ClientConnInterface
+	}
+	if c.groups == nil {
+		c.groups = make(map[string]grayReleaseConn)
+	}
+	c.groups[group] = conn
+	return conn
+}
+
+// closeStaleGroups 关闭不在新策略中的分组连接
+func (c *grayReleaseClientConn) closeStaleGroups(policy *grpcresolver.GrayReleasePolicy) {
+	for group, conn := range c.groups {
+		if policy != nil && policy.HasGroup(group) {
+			continue
+		}
+		delete(c.groups, group)
+		time.AfterFunc(grayReleaseConnCloseDelay, func() {
+			if err := conn.Close(); err != nil {
+				grpclog.Warningf("close gray release group %s/%s error: %v", c.serviceName, group, err)
+			}
+		})
+	}
+}
+
+func (c *grayReleaseClientConn) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	return c.pick(ctx).Invoke(ctx, method, args, reply, opts...)
+}
+
+func (c *grayReleaseClientConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.pick(ctx).NewStream(ctx, desc, method, opts...)
+}
@@ -0,0 +1,80 @@
+package grpcx
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/grpcx/grpcresolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+type testPolicies struct {
+	resolver.Builder
+	policy atomic.Pointer[grpcresolver.GrayReleasePolicy]
+}
+
+func (p *testPolicies) GrayReleasePolicy(serviceName string) *grpcresolver.GrayReleasePolicy {
+	return p.policy.Load()
+}
+
+type testGroupConn struct {
+	grpc.ClientConnInterface
+	group  string
+	closed chan struct{}
+}
+
+func (c *testGroupConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestGrayReleaseCloseStaleGroups(t *testing.T) {
+	old := grayReleaseConnCloseDelay
+	grayReleaseConnCloseDelay = 0
+	defer func() { grayReleaseConnCloseDelay = old }()
+
+	policies := &testPolicies{}
+	policies.policy.Store(&grpcresolver.GrayReleasePolicy{Rules: []grpcresolver.GrayReleaseRule{
+		{Group: "canary", Match: map[string]string{"canary": "true"}},
+	}})
+	dialed := 0
+	c := &grayReleaseClientConn{
+		serviceName: "app",
+		policies:    policies,
+		dial: func(group string) (grayReleaseConn, error) {
+			dialed++
+			return &testGroupConn{group: group, closed: make(chan struct{})}, nil
+		},
+	}
+	canaryCtx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("canary", "true"))
+	conn, ok := c.pick(canaryCtx).(*testGroupConn)
+	if !ok || conn.group != "canary" {
+		t.Fatalf("expected canary group conn, got %v", conn)
+	}
+	if c.pick(canaryCtx) != conn || dialed != 1 {
+		t.Fatalf("group conn should be reused, dialed %d", dialed)
+	}
+	if c.pick(context.Background()) != nil {
+		t.Error("request without match should use the default conn")
+	}
+
+	// 策略变更后不再使用的分组连接被关闭
+	policies.policy.Store(&grpcresolver.GrayReleasePolicy{Rules: []grpcresolver.GrayReleaseRule{
+		{Group: "beta", Match: map[string]string{"beta": "true"}},
+	}})
+	if c.pick(canaryCtx) != nil {
+		t.Error("removed group should use the default conn")
+	}
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatal("stale group conn not closed")
+	}
+	if len(c.groups) != 0 {
+		t.Errorf("unexpected groups %v", c.groups)
+	}
+}
@@ -2,8 +2,10 @@ package grpcoptions
 
 import (
 	"flag"
+	"time"
 
 	"github.com/daemtri/begonia/di/box/validate"
+	"github.com/daemtri/begonia/grpcx/grpctls"
 )
 
 type Options struct {
@@ -13,6 +15,10 @@ type Options struct {
 	InitialWindowSize     int
 	InitialConnWindowSize int
 	MaxConcurrentStreams  uint
+
+	// ServerTLS RuntimeServer和RelayServer的TLS参数，ClientTLS RelayClient和AppClient的TLS参数
+	ServerTLS grpctls.Options
+	ClientTLS grpctls.Options
 }
 
 func NewOptions() Options {
@@ -23,6 +29,8 @@ func NewOptions() Options {
 		InitialWindowSize:     1 * 1024 * 1024,
 		InitialConnWindowSize: 1 * 1024 * 1024,
 		MaxConcurrentStreams:  10000,
+		ServerTLS:             grpctls.Options{Reload: 10 * time.Second},
+		ClientTLS:             grpctls.Options{Reload: 10 * time.Second},
 	}
 	return s
 }
@@ -38,4 +46,13 @@ func (o *Options) AddFlags(fs *flag.FlagSet) {
 	fs.IntVar(&o.InitialWindowSize, "init-window-size", o.InitialWindowSize, "GRPC InitialWindowSize")
 	fs.IntVar(&o.InitialConnWindowSize, "init-conn-window-size", o.InitialConnWindowSize, "GRPC InitialConnWindowSize")
 	fs.UintVar(&o.MaxConcurrentStreams, "max-concurrent-streams", o.MaxConcurrentStreams, "GRPC MaxConcurrentStreams")
+	fs.StringVar(&o.ServerTLS.CertFile, "server-tls-cert", o.ServerTLS.CertFile, "GRPC server TLS cert file")
+	fs.StringVar(&o.ServerTLS.KeyFile, "server-tls-key", o.ServerTLS.KeyFile, "GRPC server TLS key file")
+	fs.StringVar(&o.ServerTLS.CAFile, "server-tls-ca", o.ServerTLS.CAFile, "GRPC server TLS CA file for client certs")
+	fs.BoolVar(&o.ServerTLS.ClientAuth, "server-tls-client-auth", o.ServerTLS.ClientAuth, "GRPC server require client certs")
+	fs.BoolVar(&o.ClientTLS.Enable, "client-tls-enable", o.ClientTLS.Enable, "GRPC client use TLS")
+	fs.StringVar(&o.ClientTLS.CertFile, "client-tls-cert", o.ClientTLS.CertFile, "GRPC client TLS cert file")
+	fs.StringVar(&o.ClientTLS.KeyFile, "client-tls-key", o.ClientTLS.KeyFile, "GRPC client TLS key file")
+	fs.StringVar(&o.ClientTLS.CAFile, "client-tls-ca", o.ClientTLS.CAFile, "GRPC client TLS CA file")
+	fs.StringVar(&o.ClientTLS.ServerName, "client-tls-server-name", o.ClientTLS.ServerName, "GRPC client TLS server name override")
 }
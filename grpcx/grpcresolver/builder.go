@@ -1,19 +1,74 @@
 package grpcresolver
 
 import (
+	"sync"
+	"time"
+
 	"github.com/daemtri/begonia/runtime/component"
 	"google.golang.org/grpc/resolver"
 )
 
+const (
+	DefaultInitTimeout = 5 * time.Second
+	DefaultMinBackoff  = 100 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+)
+
+// Options resolver的参数
+type Options struct {
+	// InitTimeout 等待第一次服务发现结果的超时时间，超时后使用快照或者报告错误，并在后台继续重试
+	InitTimeout time.Duration
+	// SnapshotDir 服务发现快照目录，为空时不保存快照
+	SnapshotDir string
+	// MinBackoff 和 MaxBackoff 服务发现出错后重新watch的退避时间
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Option func(*Options)
+
+// WithInitTimeout 设置等待第一次服务发现结果的超时时间
+func WithInitTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.InitTimeout = timeout
+	}
+}
+
+// WithSnapshotDir 设置服务发现快照目录，服务发现不可用时使用最后一次成功的结果
+func WithSnapshotDir(dir string) Option {
+	return func(o *Options) {
+		o.SnapshotDir = dir
+	}
+}
+
+// WithBackoff 设置服务发现出错后重新watch的退避时间
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.MinBackoff, o.MaxBackoff = min, max
+	}
+}
+
+// Builder 创建服务发现的resolver，并保存这些resolver解析到的灰度策略
+type Builder interface {
+	resolver.Builder
+	// GrayReleasePolicy 返回服务当前的灰度策略，没有灰度策略时返回nil
+	GrayReleasePolicy(serviceName string) *GrayReleasePolicy
+}
+
 // RegisterInCluster registers the solver builder to grpc with sgr schema
-func RegisterInCluster(name string, reg component.Discovery) {
-	resolver.Register(NewBuilder(name, reg))
+func RegisterInCluster(name string, reg component.Discovery, opts ...Option) Builder {
+	b := NewBuilder(name, reg, opts...)
+	resolver.Register(b)
+	return b
 }
 
 // mdnsBuilder implements the builder interface of grpc resolver
 type sgrBuilder struct {
 	schema    string
 	registrar component.Discovery
+	opts      Options
+	// policies 服务名到灰度策略，每个builder单独保存
+	policies sync.Map
 }
 
 // Build creates a new resolver for the given target.
@@ -31,6 +86,8 @@ func (b *sgrBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts
 		clientConn:           cc,
 		disableServiceConfig: opts.DisableServiceConfig,
 		discovery:            b.registrar,
+		opts:                 b.opts,
+		builder:              b,
 	}
 
 	return d, d.Init()
@@ -42,6 +99,18 @@ func (b *sgrBuilder) Scheme() string {
 	return b.schema
 }
 
-func NewBuilder(name string, reg component.Discovery) resolver.Builder {
-	return &sgrBuilder{schema: name, registrar: reg}
+func NewBuilder(name string, reg component.Discovery, opts ...Option) Builder {
+	b := &sgrBuilder{
+		schema:    name,
+		registrar: reg,
+		opts: Options{
+			InitTimeout: DefaultInitTimeout,
+			MinBackoff:  DefaultMinBackoff,
+			MaxBackoff:  DefaultMaxBackoff,
+		},
+	}
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+	return b
 }
@@ -1,10 +1,23 @@
 package grpcresolver
 
-import "github.com/daemtri/begonia/runtime/component"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+// ServiceConfig 服务发现下发的服务配置
 type ServiceConfig struct {
+	// LoadBalancingConfig 负载均衡策略名称，如：round_robin
+	// 也可以是包含参数的json，如：{"ring_hash_experimental":{"minRingSize":1024}}
 	LoadBalancingConfig string
-	GrayReleaseConfig   string
+	// GrayReleaseConfig 灰度发布策略，见GrayReleasePolicy
+	GrayReleaseConfig string
+	// ServiceConfig 完整的grpc service config json，包含重试、方法超时、hedging和负载均衡等配置，优先于LoadBalancingConfig
+	// see https://github.com/grpc/grpc/blob/master/doc/service_config.md
+	ServiceConfig string
 }
 
 func parseServiceConfig(scs []component.ConfigItem) (sc ServiceConfig) {
@@ -14,7 +27,30 @@ func parseServiceConfig(scs []component.ConfigItem) (sc ServiceConfig) {
 			sc.LoadBalancingConfig = scs[i].Value
 		case "GrayReleaseConfig":
 			sc.GrayReleaseConfig = scs[i].Value
+		case "ServiceConfig":
+			sc.ServiceConfig = scs[i].Value
 		}
 	}
 	return
 }
+
+// serviceConfigJSON 返回grpc service config json，没有配置时返回空字符串
+func (sc ServiceConfig) serviceConfigJSON() (string, error) {
+	if sc.ServiceConfig != "" {
+		if !json.Valid([]byte(sc.ServiceConfig)) {
+			return "", fmt.Errorf("service config is not valid json: %s", sc.ServiceConfig)
+		}
+		return sc.ServiceConfig, nil
+	}
+	lbc := strings.TrimSpace(sc.LoadBalancingConfig)
+	if lbc == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(lbc, "{") {
+		if !json.Valid([]byte(lbc)) {
+			return "", fmt.Errorf("load balancing config is not valid json: %s", lbc)
+		}
+		return fmt.Sprintf(`{"loadBalancingConfig": [%s]}`, lbc), nil
+	}
+	return fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{}}]}`, lbc), nil
+}
@@ -0,0 +1,69 @@
+package grpcresolver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/daemtri/begonia/runtime/component"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type fakeClientConn struct {
+	resolver.ClientConn
+}
+
+// ParseServiceConfig 模拟grpc的校验，包含unknown_policy时返回错误
+func (f *fakeClientConn) ParseServiceConfig(scJSON string) *serviceconfig.ParseResult {
+	if strings.Contains(scJSON, "unknown_policy") {
+		return &serviceconfig.ParseResult{Err: errors.New("unknown balancer")}
+	}
+	return &serviceconfig.ParseResult{}
+}
+
+func TestServiceConfigJSON(t *testing.T) {
+	cases := []struct {
+		configs []component.ConfigItem
+		want    string
+		err     bool
+	}{
+		{nil, "", false},
+		{[]component.ConfigItem{{Key: "LoadBalancingConfig", Value: "round_robin"}}, `{"loadBalancingConfig": [{"round_robin":{}}]}`, false},
+		{[]component.ConfigItem{{Key: "LoadBalancingConfig", Value: `{"ring_hash_experimental":{"minRingSize":1024}}`}}, `{"loadBalancingConfig": [{"ring_hash_experimental":{"minRingSize":1024}}]}`, false},
+		{[]component.ConfigItem{{Key: "LoadBalancingConfig", Value: `{"round_robin":`}}, "", true},
+		{[]component.ConfigItem{
+			{Key: "LoadBalancingConfig", Value: "round_robin"},
+			{Key: "ServiceConfig", Value: `{"methodConfig":[{"name":[{}],"timeout":"1s"}]}`},
+		}, `{"methodConfig":[{"name":[{}],"timeout":"1s"}]}`, false},
+		{[]component.ConfigItem{{Key: "ServiceConfig", Value: `{"methodConfig":`}}, "", true},
+	}
+	for _, c := range cases {
+		got, err := parseServiceConfig(c.configs).serviceConfigJSON()
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("configs %+v: want %q err=%v, got %q %v", c.configs, c.want, c.err, got, err)
+		}
+	}
+}
+
+func TestParseServiceConfigFallback(t *testing.T) {
+	sr := &sgrResolver{target: &targetInfo{serviceName: "app"}, clientConn: &fakeClientConn{}}
+	good := sr.parseServiceConfig(ServiceConfig{LoadBalancingConfig: "round_robin"})
+	if good == nil || good.Err != nil {
+		t.Fatalf("unexpected result %+v", good)
+	}
+	// 错误的配置使用上一次正确的配置
+	if got := sr.parseServiceConfig(ServiceConfig{LoadBalancingConfig: "unknown_policy"}); got != good {
+		t.Fatalf("expected last good config, got %+v", got)
+	}
+	if got := sr.parseServiceConfig(ServiceConfig{ServiceConfig: "{"}); got != good {
+		t.Fatalf("expected last good config, got %+v", got)
+	}
+	// 配置被删除后使用拨号时的默认配置
+	if got := sr.parseServiceConfig(ServiceConfig{}); got != nil {
+		t.Fatalf("expected nil, got %+v", got)
+	}
+	if got := sr.parseServiceConfig(ServiceConfig{LoadBalancingConfig: "unknown_policy"}); got != nil {
+		t.Fatalf("expected nil, got %+v", got)
+	}
+}
@@ -1,41 +1,228 @@
 package grpcresolver
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"slices"
+	"strings"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/daemtri/begonia/runtime/component"
+	"google.golang.org/grpc/metadata"
 )
 
-// grayReleaseHandle 处理同时存在多个版本的情况
-func grayReleaseHandle(sis []component.ServiceEntry, grc string) []component.ServiceEntry {
+const (
+	// GrayReleaseVersionKey Selector中表示实例版本的key
+	GrayReleaseVersionKey = "version"
+	// GrayReleaseUserKey 请求metadata中用于计算用户哈希的key
+	GrayReleaseUserKey = "user_id"
+)
+
+// GrayReleasePolicy 灰度发布策略，通过服务配置GrayReleaseConfig下发，值为json，如：
+//
+//	{"rules": [
+//	  {"group": "canary", "selector": {"version": "latest"}, "match": {"canary": "true"}, "percent": 10}
+//	]}
+//
+// 每条规则把Selector选中的实例划为一个分组，没有被任何规则选中的实例属于默认分组
+// 请求匹配Match或者用户哈希落在Percent范围内时路由到规则的分组，否则路由到默认分组
+// 每个分组使用单独的ClientConn，resolver只把分组内的实例交给balancer
+type GrayReleasePolicy struct {
+	Rules []GrayReleaseRule `json:"rules"`
+}
+
+type GrayReleaseRule struct {
+	// Group 分组名称，json配置中不能为空
+	Group string `json:"group"`
+	// Selector 选择实例的metadata，全部相等时选中
+	// version 匹配实例版本，值为latest或oldest时表示最新或最旧的版本
+	Selector map[string]string `json:"selector"`
+	// Match 请求的metadata全部相等时路由到该分组，如：{"canary": "true"}
+	Match map[string]string `json:"match"`
+	// Percent 按用户ID哈希路由到该分组的流量百分比，同一用户始终路由到同一分组，多条规则的百分比累加
+	Percent uint32 `json:"percent"`
+}
+
+// parseGrayReleasePolicy 解析灰度发布策略，兼容 old_version 和 latest_version
+func parseGrayReleasePolicy(grc string) (*GrayReleasePolicy, error) {
 	switch grc {
 	case "old_version":
-		return filterServiceEntry(sis, 0)
+		return &GrayReleasePolicy{Rules: []GrayReleaseRule{{Group: "", Selector: map[string]string{GrayReleaseVersionKey: "oldest"}}}}, nil
 	case "latest_version":
-		return filterServiceEntry(sis, 1)
+		return &GrayReleasePolicy{Rules: []GrayReleaseRule{{Group: "", Selector: map[string]string{GrayReleaseVersionKey: "latest"}}}}, nil
+	}
+	p := &GrayReleasePolicy{}
+	if err := json.Unmarshal([]byte(grc), p); err != nil {
+		return nil, fmt.Errorf("invalid gray release config %q: %w", grc, err)
 	}
-	return sis
+	var total uint32
+	for i := range p.Rules {
+		if p.Rules[i].Group == "" {
+			return nil, fmt.Errorf("invalid gray release config %q: rule %d has no group", grc, i)
+		}
+		total += p.Rules[i].Percent
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("invalid gray release config %q: total percent %d > 100", grc, total)
+	}
+	return p, nil
 }
 
-func filterServiceEntry(sis []component.ServiceEntry, policy int) []component.ServiceEntry {
-	if len(sis) == 0 {
-		return sis
+// Entries 返回分组内的实例，分组为空时返回默认分组，分组内没有实例时返回全部实例
+func (p *GrayReleasePolicy) Entries(sis []component.ServiceEntry, group string) []component.ServiceEntry {
+	selected := make([]bool, len(sis))
+	// 规则的分组为空时，默认分组只包含该规则选中的实例
+	explicitDefault := false
+	var ret []component.ServiceEntry
+	for _, rule := range p.Rules {
+		if rule.Group == "" {
+			explicitDefault = true
+		}
+		for i, matched := range rule.selects(sis) {
+			if !matched {
+				continue
+			}
+			selected[i] = true
+			if rule.Group == group {
+				ret = append(ret, sis[i])
+			}
+		}
 	}
-	slices.SortFunc(sis, func(left, right component.ServiceEntry) int {
-		if policy <= 0 {
-			return semver.New(left.Version).Compare(*semver.New(right.Version))
+	if group == "" && !explicitDefault {
+		for i := range sis {
+			if !selected[i] {
+				ret = append(ret, sis[i])
+			}
 		}
-		return semver.New(right.Version).Compare(*semver.New(left.Version))
-	})
-	ret := make([]component.ServiceEntry, 0, len(sis))
-	ret = append(ret, sis[0])
-	for i := 1; i < len(sis); i++ {
-		if sis[i].Version == ret[0].Version {
-			ret = append(ret, sis[i])
-		} else {
-			break
+	}
+	if len(ret) == 0 {
+		return sis
+	}
+	return ret
+}
+
+// selects 返回每个实例是否被规则选中
+func (r *GrayReleaseRule) selects(sis []component.ServiceEntry) []bool {
+	version := r.Selector[GrayReleaseVersionKey]
+	switch version {
+	case "latest":
+		version = extremeVersion(sis, 1)
+	case "oldest":
+		version = extremeVersion(sis, -1)
+	}
+	ret := make([]bool, len(sis))
+	for i := range sis {
+		ret[i] = true
+		for k, v := range r.Selector {
+			if k == GrayReleaseVersionKey {
+				ret[i] = ret[i] && sis[i].Version == version
+			} else {
+				ret[i] = ret[i] && sis[i].Metadata[k] == v
+			}
 		}
 	}
 	return ret
 }
+
+// PickGroup 根据请求的metadata选择分组，返回空字符串表示默认分组
+func (p *GrayReleasePolicy) PickGroup(ctx context.Context) string {
+	md := requestMetadata(ctx)
+	for _, rule := range p.Rules {
+		if len(rule.Match) == 0 {
+			continue
+		}
+		matched := true
+		for k, v := range rule.Match {
+			if values := md.Get(k); len(values) == 0 || values[0] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.Group
+		}
+	}
+	users := md.Get(GrayReleaseUserKey)
+	if len(users) == 0 || users[0] == "" {
+		return ""
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(users[0]))
+	bucket := h.Sum32() % 100
+	var acc uint32
+	for _, rule := range p.Rules {
+		acc += rule.Percent
+		if bucket < acc {
+			return rule.Group
+		}
+	}
+	return ""
+}
+
+// requestMetadata 合并incoming和outgoing的metadata，outgoing优先
+func requestMetadata(ctx context.Context) metadata.MD {
+	in, _ := metadata.FromIncomingContext(ctx)
+	out, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.Join(out, in)
+}
+
+// HasGroup 策略中是否存在分组
+func (p *GrayReleasePolicy) HasGroup(group string) bool {
+	for _, rule := range p.Rules {
+		if rule.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// setGrayReleasePolicy 保存服务的灰度策略，供GrayReleasePolicy使用
+func (b *sgrBuilder) setGrayReleasePolicy(serviceName string, p *GrayReleasePolicy) {
+	if p == nil {
+		b.policies.Delete(serviceName)
+		return
+	}
+	b.policies.Store(serviceName, p)
+}
+
+// GrayReleasePolicy 返回builder创建的resolver解析到的服务灰度策略，没有灰度策略时返回nil
+func (b *sgrBuilder) GrayReleasePolicy(serviceName string) *GrayReleasePolicy {
+	p, ok := b.policies.Load(serviceName)
+	if !ok {
+		return nil
+	}
+	return p.(*GrayReleasePolicy)
+}
+
+// extremeVersion 返回最新(order>0)或最旧(order<0)的版本，无法解析的版本视为最旧
+func extremeVersion(sis []component.ServiceEntry, order int) string {
+	if len(sis) == 0 {
+		return ""
+	}
+	versions := make([]string, 0, len(sis))
+	for i := range sis {
+		versions = append(versions, sis[i].Version)
+	}
+	slices.SortStableFunc(versions, compareVersion)
+	if order > 0 {
+		return versions[len(versions)-1]
+	}
+	return versions[0]
+}
+
+// compareVersion 比较语义化版本，支持v前缀，无法解析的版本小于可以解析的版本
+func compareVersion(left, right string) int {
+	lv, lerr := semver.NewVersion(strings.TrimPrefix(left, "v"))
+	rv, rerr := semver.NewVersion(strings.TrimPrefix(right, "v"))
+	switch {
+	case lerr != nil && rerr != nil:
+		return strings.Compare(left, right)
+	case lerr != nil:
+		return -1
+	case rerr != nil:
+		return 1
+	}
+	return lv.Compare(*rv)
+}
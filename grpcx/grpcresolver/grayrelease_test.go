@@ -0,0 +1,78 @@
+package grpcresolver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/daemtri/begonia/runtime/component"
+	"google.golang.org/grpc/metadata"
+)
+
+func ids(sis []component.ServiceEntry) string {
+	ret := ""
+	for i := range sis {
+		ret += sis[i].ID
+	}
+	return ret
+}
+
+func TestGrayReleaseEntries(t *testing.T) {
+	sis := []component.ServiceEntry{
+		{ID: "a", Version: "v1.0.0"},
+		{ID: "b", Version: "v1.1.0"},
+		{ID: "c", Version: "dev", Metadata: map[string]string{"canary": "true"}},
+	}
+	cases := []struct {
+		config string
+		group  string
+		want   string
+	}{
+		{"old_version", "", "c"},
+		{"latest_version", "", "b"},
+		{`{"rules":[{"group":"canary","selector":{"canary":"true"}}]}`, "", "ab"},
+		{`{"rules":[{"group":"canary","selector":{"canary":"true"}}]}`, "canary", "c"},
+		{`{"rules":[{"group":"new","selector":{"version":"latest"}}]}`, "new", "b"},
+		{`{"rules":[{"group":"new","selector":{"version":"v9"}}]}`, "new", "abc"},
+	}
+	for _, c := range cases {
+		p, err := parseGrayReleasePolicy(c.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(p.Entries(sis, c.group)); got != c.want {
+			t.Errorf("config %s group %q: want %s, got %s", c.config, c.group, c.want, got)
+		}
+	}
+	if _, err := parseGrayReleasePolicy(`{"rules":[{"group":"a","percent":60},{"group":"b","percent":60}]}`); err == nil {
+		t.Error("expected error for total percent > 100")
+	}
+}
+
+func TestGrayReleasePickGroup(t *testing.T) {
+	p, err := parseGrayReleasePolicy(`{"rules":[{"group":"canary","match":{"canary":"true"},"percent":30}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("canary", "true"))
+	if g := p.PickGroup(ctx); g != "canary" {
+		t.Fatalf("expected canary, got %q", g)
+	}
+	if g := p.PickGroup(context.Background()); g != "" {
+		t.Fatalf("expected default group, got %q", g)
+	}
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(GrayReleaseUserKey, fmt.Sprint(i)))
+		g := p.PickGroup(ctx)
+		if g != p.PickGroup(ctx) {
+			t.Fatal("user is not sticky")
+		}
+		if g == "canary" {
+			hits++
+		}
+	}
+	if hits < 200 || hits > 400 {
+		t.Fatalf("expected about 30%% users in canary, got %d/1000", hits)
+	}
+}
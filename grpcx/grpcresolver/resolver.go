@@ -2,7 +2,6 @@ package grpcresolver
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -10,6 +9,7 @@ import (
 	"github.com/daemtri/begonia/runtime/component"
 	"google.golang.org/grpc/attributes"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
 )
 
 const (
@@ -41,6 +41,7 @@ type sgrResolver struct {
 	disableServiceConfig bool
 
 	discovery component.Discovery
+	builder   *sgrBuilder
 
 	ctx       context.Context
 	ctxCancel context.CancelFunc
@@ -49,6 +50,15 @@ type sgrResolver struct {
 	currentServiceConfig  ServiceConfig
 
 	schema string
+	// group 灰度分组，为空时表示默认分组
+	group string
+	// lastServiceConfig 上一次正确的服务配置
+	lastServiceConfig *serviceconfig.ParseResult
+
+	opts Options
+	// resolved 是否已经更新过连接状态，包括使用快照
+	resolved   bool
+	resolveNow chan struct{}
 }
 
 func (sr *sgrResolver) Init() error {
@@ -56,25 +66,45 @@ func (sr *sgrResolver) Init() error {
 	if schema := sr.target.target.URL.Query().Get("schema"); schema != "" {
 		sr.schema = schema
 	}
+	sr.group = sr.target.target.URL.Query().Get("group")
+	sr.ctx, sr.ctxCancel = context.WithCancel(context.Background())
 	if ses, ok := services[sr.target.serviceName]; ok {
 		sr.currentServiceEntries = ses
 		sr.updateClientConnState()
 		return nil
 	}
 
-	sr.ctx, sr.ctxCancel = context.WithCancel(context.Background())
-	iter := sr.discovery.Watch(sr.ctx, sr.target.serviceName)
-	service, err := iter.Next()
-	if err != nil {
-		return err
-	}
-	// TODO: 增加超时机制
-	sr.currentServiceEntries = service.Entries
-	sr.currentServiceConfig = parseServiceConfig(service.Configs)
-	sr.updateClientConnState()
+	sr.resolveNow = make(chan struct{}, 1)
+	results := make(chan watchResult, 1)
+	go sr.receive(results)
 
-	go sr.watch(iter)
-	logger.Info("Sgr GRPC resolver 初始化成功", "schema", sr.schema)
+	// 等待第一次服务发现结果，超时或者出错时不返回错误，避免拨号失败，后台继续重试
+	timer := time.NewTimer(sr.opts.InitTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case r := <-results:
+		if r.err == nil {
+			sr.update(r.service)
+			go sr.watch(results)
+			logger.Info("Sgr GRPC resolver 初始化成功", "schema", sr.schema)
+			return nil
+		}
+		err = r.err
+	case <-timer.C:
+		err = fmt.Errorf("resolve service %s timeout after %s", sr.target.serviceName, sr.opts.InitTimeout)
+	}
+	if service, serr := loadSnapshot(sr.opts.SnapshotDir, sr.target.serviceName); serr == nil {
+		logger.Warning("服务发现不可用,使用快照", "service", sr.target.serviceName, "error", err)
+		sr.resolved = true
+		sr.currentServiceEntries = service.Entries
+		sr.currentServiceConfig = parseServiceConfig(service.Configs)
+		sr.updateClientConnState()
+	} else {
+		logger.Warning("服务发现不可用,后台继续重试", "service", sr.target.serviceName, "error", err)
+		sr.clientConn.ReportError(err)
+	}
+	go sr.watch(results)
 	return nil
 }
 
@@ -83,8 +113,19 @@ func (sr *sgrResolver) updateClientConnState() {
 	sc := sr.currentServiceConfig
 
 	logger.Info("正在变更本地服务发现信息", sis, sc)
+	var policy *GrayReleasePolicy
 	if sc.GrayReleaseConfig != "" {
-		sis = grayReleaseHandle(sis, sc.GrayReleaseConfig)
+		var err error
+		policy, err = parseGrayReleasePolicy(sc.GrayReleaseConfig)
+		if err != nil {
+			logger.Warning("灰度发布配置错误,忽略灰度策略", "error", err)
+		} else {
+			sis = policy.Entries(sis, sr.group)
+		}
+	}
+	// 分组的resolver只解析分组内的实例，灰度策略以默认分组的resolver为准
+	if sr.group == "" {
+		sr.builder.setGrayReleasePolicy(sr.target.serviceName, policy)
 	}
 	address := make([]resolver.Address, 0, len(sis))
 	for i := range sis {
@@ -99,9 +140,14 @@ func (sr *sgrResolver) updateClientConnState() {
 				endpoint = strings.TrimPrefix(current, sr.schema)
 			}
 		}
-		if endpoint == "" && len(sis[i].Endpoints) == 1 {
+		// 没有schema的endpoint兼容旧的注册信息，其他schema的endpoint不使用，避免启用TLS时连接到非加密的endpoint
+		if endpoint == "" && len(sis[i].Endpoints) == 1 && !strings.Contains(sis[i].Endpoints[0], "://") {
 			endpoint = sis[i].Endpoints[0]
 		}
+		if endpoint == "" {
+			logger.Warning("实例没有匹配schema的endpoint,忽略该实例", "id", sis[i].ID, "schema", sr.schema, "endpoints", sis[i].Endpoints)
+			continue
+		}
 		addr := resolver.Address{
 			Addr:               endpoint,
 			ServerName:         sr.target.serviceName,
@@ -114,11 +160,8 @@ func (sr *sgrResolver) updateClientConnState() {
 		Addresses:  address,
 		Attributes: attributes.New("resolver", "sgr"),
 	}
-	if !sr.disableServiceConfig && sc.LoadBalancingConfig != "" {
-		// TODO: 负载均衡配置
-		// see https://github.com/grpc/grpc/blob/master/doc/service_config.md
-		serviceConfigJSON := fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{}}]}`, sc.LoadBalancingConfig)
-		state.ServiceConfig = sr.clientConn.ParseServiceConfig(serviceConfigJSON)
+	if !sr.disableServiceConfig {
+		state.ServiceConfig = sr.parseServiceConfig(sc)
 	}
 	logger.Info("服务状态已更新", "state", state)
 
@@ -128,38 +171,114 @@ func (sr *sgrResolver) updateClientConnState() {
 	}
 }
 
-func (sr *sgrResolver) watch(iter component.Stream[*component.Service]) {
-	emptyTimer := time.NewTimer(DefaultUpdateEmptyConnStateDelay)
-	emptyTimer.Stop()
-	ch := make(chan *component.Service, 1)
-	go func() {
+// parseServiceConfig 解析并校验服务配置，配置错误时使用上一次正确的配置
+// 没有正确的配置时返回nil，使用拨号时的默认配置
+func (sr *sgrResolver) parseServiceConfig(sc ServiceConfig) *serviceconfig.ParseResult {
+	scJSON, err := sc.serviceConfigJSON()
+	if err == nil && scJSON == "" {
+		sr.lastServiceConfig = nil
+		return nil
+	}
+	if err == nil {
+		result := sr.clientConn.ParseServiceConfig(scJSON)
+		if result.Err == nil {
+			sr.lastServiceConfig = result
+			return result
+		}
+		err = result.Err
+	}
+	logger.Warning("服务配置错误,使用上一次正确的配置", "service", sr.target.serviceName, "error", err)
+	return sr.lastServiceConfig
+}
+
+// watchResult 服务发现的结果
+type watchResult struct {
+	service *component.Service
+	err     error
+}
+
+// receive 持续watch服务发现，出错后按退避时间重新watch，结果和错误都发送到results
+func (sr *sgrResolver) receive(results chan<- watchResult) {
+	send := func(r watchResult) bool {
+		select {
+		case results <- r:
+			return true
+		case <-sr.ctx.Done():
+			return false
+		}
+	}
+	backoff := sr.opts.MinBackoff
+	for {
+		iter := sr.discovery.Watch(sr.ctx, sr.target.serviceName)
+		var err error
 		for {
-			service, err := iter.Next()
+			var service *component.Service
+			service, err = iter.Next()
 			if err != nil {
-				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
-					close(ch)
-					return
-				}
-				logger.Warning("服务发现迭代出错", "err", err)
+				break
+			}
+			backoff = sr.opts.MinBackoff
+			if !send(watchResult{service: service}) {
+				iter.Stop()
 				return
 			}
-			ch <- service
 		}
-	}()
+		iter.Stop()
+		if sr.ctx.Err() != nil {
+			return
+		}
+		if !send(watchResult{err: err}) {
+			return
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-sr.ctx.Done():
+			timer.Stop()
+			return
+		case <-sr.resolveNow:
+			timer.Stop()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, sr.opts.MaxBackoff)
+	}
+}
+
+// update 更新服务发现结果并保存快照，没有实例时不保存，避免覆盖可用的快照
+func (sr *sgrResolver) update(service *component.Service) {
+	sr.resolved = true
+	sr.currentServiceEntries = service.Entries
+	sr.currentServiceConfig = parseServiceConfig(service.Configs)
+	sr.updateClientConnState()
+	if len(service.Entries) == 0 {
+		return
+	}
+	if err := saveSnapshot(sr.opts.SnapshotDir, sr.target.serviceName, service); err != nil {
+		logger.Warning("保存服务发现快照失败", "service", sr.target.serviceName, "error", err)
+	}
+}
+
+func (sr *sgrResolver) watch(results <-chan watchResult) {
+	emptyTimer := time.NewTimer(DefaultUpdateEmptyConnStateDelay)
+	emptyTimer.Stop()
 	for {
 		select {
-		case service, ok := <-ch:
-			if !ok {
-				logger.Infof("服务解析Watch服务发现组件通道已关闭")
-				return
+		case r := <-results:
+			if r.err != nil {
+				logger.Warning("服务发现迭代出错,稍后重试", "service", sr.target.serviceName, "err", r.err)
+				// 还没有成功解析过时报告错误，已有的连接继续使用
+				if !sr.resolved {
+					sr.clientConn.ReportError(r.err)
+				}
+				continue
 			}
+			service := r.service
 			logger.Infoln("sgrResolver watch update", "service", service)
-			sr.currentServiceEntries = service.Entries
-			sr.currentServiceConfig = parseServiceConfig(service.Configs)
-			if len(service.Entries) == 0 {
+			if len(service.Entries) == 0 && sr.resolved {
+				sr.currentServiceEntries = service.Entries
+				sr.currentServiceConfig = parseServiceConfig(service.Configs)
 				emptyTimer.Reset(DefaultUpdateEmptyConnStateDelay)
 			} else {
-				sr.updateClientConnState()
+				sr.update(service)
 			}
 		case <-emptyTimer.C:
 			if len(sr.currentServiceEntries) == 0 {
@@ -173,11 +292,15 @@ func (sr *sgrResolver) watch(iter component.Stream[*component.Service]) {
 }
 
 // ResolveNow 会被gRPC调用来尝试解析target name
-// 可能会被同时并发调用或者多次调用
-func (sr *sgrResolver) ResolveNow(opt resolver.ResolveNowOptions) {}
+// 可能会被同时并发调用或者多次调用，服务发现出错时立即重新watch
+func (sr *sgrResolver) ResolveNow(opt resolver.ResolveNowOptions) {
+	select {
+	case sr.resolveNow <- struct{}{}:
+	default:
+	}
+}
 
 // Close closes the resolver.
 func (sr *sgrResolver) Close() {
 	sr.ctxCancel()
-	sr.ctx.Deadline()
 }
@@ -0,0 +1,157 @@
+package grpcresolver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/runtime/component"
+	"google.golang.org/grpc/resolver"
+)
+
+// failingDiscovery 前failures次watch返回错误
+type failingDiscovery struct {
+	component.Discovery
+
+	mux      sync.Mutex
+	failures int
+	service  *component.Service
+}
+
+func (d *failingDiscovery) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	s := component.NewChanStream[*component.Service](ctx)
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.failures > 0 {
+		d.failures--
+		go s.Send(nil, errors.New("discovery unavailable"))
+	} else {
+		go s.Send(d.service, nil)
+	}
+	return s
+}
+
+type recordClientConn struct {
+	fakeClientConn
+
+	mux    sync.Mutex
+	states []resolver.State
+	errs   []error
+}
+
+func (r *recordClientConn) UpdateState(state resolver.State) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.states = append(r.states, state)
+	return nil
+}
+
+func (r *recordClientConn) ReportError(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *recordClientConn) counts() (int, int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.states), len(r.errs)
+}
+
+func buildResolver(t *testing.T, d component.Discovery, cc resolver.ClientConn, opts ...Option) resolver.Resolver {
+	target := resolver.Target{URL: url.URL{Scheme: "relay", Host: "app", Path: "/", RawQuery: "schema=grpc://"}}
+	r, err := NewBuilder("relay", d, opts...).Build(target, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestResolverRetry(t *testing.T) {
+	dir := t.TempDir()
+	service := &component.Service{Entries: []component.ServiceEntry{{ID: "1", Name: "app", Endpoints: []string{"grpc://127.0.0.1:8090"}}}}
+	d := &failingDiscovery{failures: 2, service: service}
+	cc := &recordClientConn{}
+	r := buildResolver(t, d, cc, WithSnapshotDir(dir), WithBackoff(10*time.Millisecond, 10*time.Millisecond))
+	defer r.Close()
+
+	// 第一次失败时报告错误，后台重试成功后更新状态并保存快照
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		states, errs := cc.counts()
+		if states == 1 {
+			if errs == 0 {
+				t.Fatal("expected ReportError before discovery recovered")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("resolver not recovered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cc.states[0].Addresses[0].Addr != "127.0.0.1:8090" {
+		t.Fatalf("unexpected state %+v", cc.states[0])
+	}
+	if _, err := loadSnapshot(dir, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务发现不可用时使用快照，不报告错误
+	cc2 := &recordClientConn{}
+	r2 := buildResolver(t, &failingDiscovery{failures: 1 << 20}, cc2,
+		WithSnapshotDir(dir), WithInitTimeout(time.Second), WithBackoff(time.Hour, time.Hour))
+	defer r2.Close()
+	if states, errs := cc2.counts(); states != 1 || errs != 0 {
+		t.Fatalf("expected state from snapshot, got %d states %d errors", states, errs)
+	}
+}
+
+func TestResolverInitTimeout(t *testing.T) {
+	cc := &recordClientConn{}
+	start := time.Now()
+	r := buildResolver(t, &blockingDiscovery{}, cc, WithInitTimeout(50*time.Millisecond))
+	defer r.Close()
+	if time.Since(start) > time.Second {
+		t.Fatal("Build blocked after init timeout")
+	}
+	if states, errs := cc.counts(); states != 0 || errs != 1 {
+		t.Fatalf("expected ReportError, got %d states %d errors", states, errs)
+	}
+}
+
+// blockingDiscovery watch永远不返回结果
+type blockingDiscovery struct {
+	component.Discovery
+}
+
+func (d *blockingDiscovery) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	return component.NewChanStream[*component.Service](ctx)
+}
+
+func TestSaveSnapshotConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	// 同一个服务的多个resolver同时保存快照
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service := &component.Service{Entries: []component.ServiceEntry{{ID: "1", Name: "app"}}}
+			if err := saveSnapshot(dir, "app", service); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if s, err := loadSnapshot(dir, "app"); err != nil || len(s.Entries) != 1 {
+		t.Fatalf("unexpected snapshot %v %v", s, err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("temp files left: %v", files)
+	}
+}
@@ -0,0 +1,62 @@
+package grpcresolver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+func snapshotFilename(dir, name string) string {
+	return filepath.Join(dir, name+".json")
+}
+
+// loadSnapshot 读取服务最后一次成功的服务发现结果
+func loadSnapshot(dir, name string) (*component.Service, error) {
+	if dir == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(snapshotFilename(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	service := &component.Service{}
+	if err := json.Unmarshal(data, service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// saveSnapshot 保存服务发现结果，先写临时文件再重命名，避免读到写了一半的文件
+func saveSnapshot(dir, name string, service *component.Service) error {
+	if dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	// 同一个服务可能有多个resolver同时保存，每次使用单独的临时文件
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), snapshotFilename(dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package grpctls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// Schema 启用TLS时服务注册和服务发现使用的endpoint schema
+	Schema = "grpcs://"
+	// InsecureSchema 未启用TLS时的endpoint schema
+	InsecureSchema = "grpc://"
+)
+
+// Options TLS参数，服务端配置了证书或者客户端开启Enable时启用TLS
+type Options struct {
+	Enable     bool          `flag:"enable" default:"false" usage:"是否使用TLS连接，配置了证书时自动开启，服务端开启时必须配置证书"`
+	CertFile   string        `flag:"cert" default:"" usage:"证书文件，服务端必须配置，客户端配置后用于mTLS"`
+	KeyFile    string        `flag:"key" default:"" usage:"证书私钥文件"`
+	CAFile     string        `flag:"ca" default:"" usage:"CA证书文件，服务端用于校验客户端证书，客户端用于校验服务端证书，为空时客户端使用系统CA"`
+	ClientAuth bool          `flag:"client_auth" default:"false" usage:"服务端是否要求并校验客户端证书(mTLS)"`
+	ServerName string        `flag:"server_name" default:"" usage:"客户端校验服务端证书使用的名称(SNI)，为空时使用服务名"`
+	Reload     time.Duration `flag:"reload" default:"10s" usage:"检查证书文件变化的间隔，证书轮换后自动加载"`
+}
+
+// Enabled 是否启用TLS
+func (o *Options) Enabled() bool {
+	return o.Enable || o.CertFile != ""
+}
+
+// Schema 返回服务注册和服务发现使用的endpoint schema
+func (o *Options) Schema() string {
+	if o.Enabled() {
+		return Schema
+	}
+	return InsecureSchema
+}
+
+func (o *Options) validate(server bool) error {
+	if server && o.CertFile == "" {
+		return fmt.Errorf("tls enabled but cert file not set")
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("tls cert and key must be set together: cert=%q key=%q", o.CertFile, o.KeyFile)
+	}
+	if server && o.ClientAuth && o.CAFile == "" {
+		return fmt.Errorf("tls client auth requires ca file")
+	}
+	return nil
+}
+
+// ServerCredentials 返回服务端的TransportCredentials，未启用TLS时返回insecure
+func (o *Options) ServerCredentials() (credentials.TransportCredentials, error) {
+	if !o.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	if err := o.validate(true); err != nil {
+		return nil, err
+	}
+	r, err := newReloader(*o)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 每次握手使用最新加载的证书和CA
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.get()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+			}
+			if o.ClientAuth {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			} else if pool != nil {
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// ClientCredentials 返回客户端的TransportCredentials，未启用TLS时返回insecure
+func (o *Options) ClientCredentials() (credentials.TransportCredentials, error) {
+	if !o.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	if err := o.validate(false); err != nil {
+		return nil, err
+	}
+	r, err := newReloader(*o)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+		// 标准库不支持动态的RootCAs，跳过默认校验后在VerifyConnection中使用最新加载的CA校验
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+	if o.CertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.get()
+			return cert, nil
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
@@ -0,0 +1,152 @@
+package grpctls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+// write 写入证书和私钥文件，返回证书文件和私钥文件
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := newCert(t, "app", ca).write(t, dir, "server")
+	clientCert, clientKey := newCert(t, "client", ca).write(t, dir, "client")
+
+	serverOpts := Options{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile, ClientAuth: true}
+	screds, err := serverOpts.ServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(screds))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	check := func(opts Options) error {
+		creds, err := opts.ClientCredentials()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+	if err := check(Options{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile, ServerName: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有客户端证书时服务端拒绝连接
+	if err := check(Options{Enable: true, CAFile: caFile, ServerName: "app"}); err == nil {
+		t.Fatal("expected error without client cert")
+	}
+	// 服务端证书名称不匹配时客户端拒绝连接
+	if err := check(Options{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile, ServerName: "other"}); err == nil {
+		t.Fatal("expected error with wrong server name")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "ca", nil)
+	certFile, keyFile := newCert(t, "app", ca).write(t, dir, "server")
+	r, err := newReloader(Options{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newCert(t, "app", ca)
+	rotated.write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	_ = os.Chtimes(keyFile, later, later)
+	cert, _ := r.get()
+	if string(cert.Certificate[0]) != string(rotated.cert.Raw) {
+		t.Fatal("certificate not reloaded")
+	}
+}
+
+func TestServerCredentialsWithoutCert(t *testing.T) {
+	// 服务端开启TLS但没有证书时报错，不能静默降级为insecure
+	opts := Options{Enable: true}
+	if _, err := opts.ServerCredentials(); err == nil {
+		t.Fatal("expected error when tls enabled without cert")
+	}
+	if _, err := (&Options{}).ServerCredentials(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package grpctls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+)
+
+var (
+	logger = logx.GetLogger("grpcx/grpctls")
+)
+
+// reloader 加载证书和CA，握手时检查文件修改时间，变化后重新加载
+type reloader struct {
+	opts Options
+
+	mux       sync.Mutex
+	checkedAt time.Time
+	modTime   time.Time
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+}
+
+func newReloader(opts Options) (*reloader, error) {
+	r := &reloader{opts: opts}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.modTime, r.checkedAt = modTime, time.Now()
+	return r, nil
+}
+
+func (r *reloader) files() []string {
+	var files []string
+	for _, file := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.CAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (r *reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range r.files() {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *reloader) load() error {
+	if r.opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load tls cert error: %w", err)
+		}
+		r.cert = &cert
+	}
+	if r.opts.CAFile != "" {
+		data, err := os.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("load tls ca error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in tls ca file %s", r.opts.CAFile)
+		}
+		r.pool = pool
+	}
+	return nil
+}
+
+// get 返回当前的证书和CA，超过检查间隔时检查文件是否变化，加载失败时继续使用旧的证书
+func (r *reloader) get() (*tls.Certificate, *x509.CertPool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if time.Since(r.checkedAt) < r.opts.Reload {
+		return r.cert, r.pool
+	}
+	r.checkedAt = time.Now()
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logger.Warn("stat tls files error", "error", err)
+		return r.cert, r.pool
+	}
+	if !modTime.After(r.modTime) {
+		return r.cert, r.pool
+	}
+	if err := r.load(); err != nil {
+		logger.Warn("reload tls files error, keep using old certificates", "error", err)
+		return r.cert, r.pool
+	}
+	r.modTime = modTime
+	logger.Info("tls certificates reloaded", "cert", r.opts.CertFile, "ca", r.opts.CAFile)
+	return r.cert, r.pool
+}
+
+// verifyServer 使用最新的CA校验服务端证书，pool为空时使用系统CA
+func (r *reloader) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server did not provide a certificate")
+	}
+	_, pool := r.get()
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,182 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const windowBuckets = 10
+
+// counts 窗口内的计数，total为请求数，hits为失败数或者重试数
+type counts struct {
+	total int
+	hits  int
+}
+
+// window 按时间滚动的计数窗口，分为windowBuckets个bucket
+type window struct {
+	buckets [windowBuckets]counts
+	current int
+	// start 当前bucket的开始时间
+	start time.Time
+}
+
+func (w *window) roll(now time.Time, size time.Duration) {
+	width := max(size/windowBuckets, time.Millisecond)
+	if w.start.IsZero() {
+		w.start = now
+		return
+	}
+	n := int(now.Sub(w.start) / width)
+	if n <= 0 {
+		return
+	}
+	for i := 0; i < min(n, windowBuckets); i++ {
+		w.current = (w.current + 1) % windowBuckets
+		w.buckets[w.current] = counts{}
+	}
+	w.start = w.start.Add(time.Duration(n) * width)
+}
+
+func (w *window) add(now time.Time, size time.Duration, total, hits int) {
+	w.roll(now, size)
+	w.buckets[w.current].total += total
+	w.buckets[w.current].hits += hits
+}
+
+func (w *window) sum(now time.Time, size time.Duration) counts {
+	w.roll(now, size)
+	var c counts
+	for i := range w.buckets {
+		c.total += w.buckets[i].total
+		c.hits += w.buckets[i].hits
+	}
+	return c
+}
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// breaker 熔断器，参数在每次调用时传入，策略变更后状态保留
+type breaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	openedAt time.Time
+	// probes 半开状态下已经放行的请求数，successes 半开状态下成功的请求数
+	probes    int
+	successes int
+	window    window
+}
+
+func (b *breaker) allow(p *BreakerPolicy, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if now.Sub(b.openedAt) < time.Duration(p.OpenTimeout) {
+			return false
+		}
+		b.state, b.probes, b.successes = stateHalfOpen, 0, 0
+		fallthrough
+	case stateHalfOpen:
+		if b.probes >= p.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// release 请求被取消没有结果，半开状态下归还放行的名额
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// record 记录请求结果，返回熔断器是否因此打开
+func (b *breaker) record(p *BreakerPolicy, now time.Time, err error) bool {
+	failed := err != nil && containsCode(p.Codes, status.Code(err))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		// 打开之前放行的请求，不再计数
+		return false
+	case stateHalfOpen:
+		if failed {
+			b.open(now)
+			return true
+		}
+		b.successes++
+		if b.successes >= p.HalfOpenRequests {
+			b.state = stateClosed
+			b.window = window{}
+		}
+		return false
+	}
+	hits := 0
+	if failed {
+		hits = 1
+	}
+	b.window.add(now, time.Duration(p.Window), 1, hits)
+	c := b.window.sum(now, time.Duration(p.Window))
+	if c.total >= p.MinRequests && float64(c.hits) >= p.ErrorRatio*float64(c.total) {
+		b.open(now)
+		return true
+	}
+	return false
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = stateOpen
+	b.openedAt = now
+	b.window = window{}
+}
+
+// budgetWindow 重试预算的统计时间
+const budgetWindow = 10 * time.Second
+
+// budget 重试预算，限制重试和对冲请求的数量，避免服务故障时重试放大流量
+type budget struct {
+	mu     sync.Mutex
+	window window
+}
+
+func (b *budget) request(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.window.add(now, budgetWindow, 1, 0)
+}
+
+// withdraw 预算足够时记录一次重试并返回true
+func (b *budget) withdraw(c *config, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sum := b.window.sum(now, budgetWindow)
+	allowed := c.budgetRatio*float64(sum.total) + c.budgetMinPerSecond*budgetWindow.Seconds()
+	if float64(sum.hits) >= allowed {
+		return false
+	}
+	b.window.add(now, budgetWindow, 0, 1)
+	return true
+}
+
+func containsCode(cs []codes.Code, c codes.Code) bool {
+	for i := range cs {
+		if cs[i] == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	logger = logx.GetLogger("grpcx/resilience")
+
+	// ErrBreakerOpen 熔断器打开时直接返回的错误，不会被重试
+	ErrBreakerOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+	resilienceEvents = metrics.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "grpc_client",
+		Name:      "resilience_events_total",
+		Help:      "gRPC客户端容错事件数，event为retry,hedge,breaker_open,breaker_reject,budget_exhausted",
+	}, []string{"service", "event"}))
+)
+
+// target 一个服务连接的容错状态，熔断器按方法区分，重试预算按连接共享
+type target struct {
+	opts     *Options
+	service  string
+	budget   budget
+	breakers sync.Map
+}
+
+// UnaryClientInterceptor 返回service的容错拦截器，每个拦截器有独立的熔断和重试预算状态
+// stream请求不经过容错策略
+func (o *Options) UnaryClientInterceptor(service string) grpc.UnaryClientInterceptor {
+	t := &target{opts: o, service: service}
+	return t.intercept
+}
+
+func (t *target) intercept(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c := t.opts.load()
+	t.budget.request(time.Now())
+	p := c.match(t.service, method)
+	if p == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	call := &call{target: t, config: c, policy: p, method: method, req: req, cc: cc, invoker: invoker, opts: opts}
+	switch {
+	case p.Hedging != nil:
+		if msg, ok := reply.(proto.Message); ok {
+			return call.hedge(ctx, msg)
+		}
+		return call.attempt(ctx, reply)
+	case p.Retry != nil:
+		return call.retry(ctx, reply)
+	default:
+		return call.attempt(ctx, reply)
+	}
+}
+
+func (t *target) breaker(method string) *breaker {
+	if b, ok := t.breakers.Load(method); ok {
+		return b.(*breaker)
+	}
+	b, _ := t.breakers.LoadOrStore(method, &breaker{})
+	return b.(*breaker)
+}
+
+func (t *target) event(event string) {
+	resilienceEvents.WithLabelValues(t.service, event).Inc()
+}
+
+type call struct {
+	*target
+	config  *config
+	policy  *Policy
+	method  string
+	req     any
+	cc      *grpc.ClientConn
+	invoker grpc.UnaryInvoker
+	opts    []grpc.CallOption
+}
+
+// attempt 发起一次请求，经过熔断器并使用每次请求的超时时间
+func (c *call) attempt(ctx context.Context, reply any) error {
+	var br *breaker
+	if c.policy.Breaker != nil {
+		br = c.breaker(c.method)
+		if !br.allow(c.policy.Breaker, time.Now()) {
+			c.event("breaker_reject")
+			return ErrBreakerOpen
+		}
+	}
+	attemptCtx := ctx
+	if c.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(c.policy.Timeout))
+		defer cancel()
+	}
+	err := c.invoker(attemptCtx, c.method, c.req, reply, c.cc, c.opts...)
+	if br == nil {
+		return err
+	}
+	// 其他hedge请求成功或者调用方取消的请求不计入熔断统计
+	if err != nil && ctx.Err() != nil {
+		br.release()
+		return err
+	}
+	if br.record(c.policy.Breaker, time.Now(), err) {
+		c.event("breaker_open")
+		logger.Warn("circuit breaker opened", "service", c.service, "method", c.method, "error", err)
+	}
+	return err
+}
+
+// retry 失败后按指数退避重试，重试需要消耗重试预算
+func (c *call) retry(ctx context.Context, reply any) error {
+	rp := c.policy.Retry
+	backoff := time.Duration(rp.InitialBackoff)
+	for attempt := 1; ; attempt++ {
+		err := c.attempt(ctx, reply)
+		if err == nil || err == ErrBreakerOpen || attempt >= rp.MaxAttempts ||
+			!containsCode(rp.Codes, status.Code(err)) || ctx.Err() != nil {
+			return err
+		}
+		if !c.budget.withdraw(c.config, time.Now()) {
+			c.event("budget_exhausted")
+			return err
+		}
+		c.event("retry")
+		if !sleepContext(ctx, jitter(backoff)) {
+			return err
+		}
+		backoff = min(backoff*2, time.Duration(rp.MaxBackoff))
+	}
+}
+
+type hedgeResult struct {
+	reply proto.Message
+	err   error
+}
+
+// hedge 第一个请求超过Delay没有返回或者返回非致命错误时发起下一个请求，使用最先成功的结果
+// 每个请求使用独立的reply，成功后合并到调用方的reply
+func (c *call) hedge(ctx context.Context, reply proto.Message) error {
+	hp := c.policy.Hedging
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, hp.MaxAttempts)
+	launched, pending := 0, 0
+	launch := func() {
+		launched++
+		pending++
+		r := reply.ProtoReflect().New().Interface()
+		go func() {
+			results <- hedgeResult{reply: r, err: c.attempt(ctx, r)}
+		}()
+	}
+	// next 预算足够时发起下一个请求
+	next := func() bool {
+		if launched >= hp.MaxAttempts || ctx.Err() != nil {
+			return false
+		}
+		if !c.budget.withdraw(c.config, time.Now()) {
+			c.event("budget_exhausted")
+			return false
+		}
+		c.event("hedge")
+		launch()
+		return true
+	}
+
+	launch()
+	timer := time.NewTimer(time.Duration(hp.Delay))
+	defer timer.Stop()
+	var err error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, r.reply)
+				return nil
+			}
+			err = r.err
+			if r.err == ErrBreakerOpen || !containsCode(hp.Codes, status.Code(r.err)) {
+				return r.err
+			}
+			if next() {
+				timer.Reset(time.Duration(hp.Delay))
+			}
+		case <-timer.C:
+			if next() {
+				timer.Reset(time.Duration(hp.Delay))
+			}
+		}
+	}
+	return err
+}
+
+// jitter 返回[d/2, d]之间的随机时间，避免重试同时发生
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
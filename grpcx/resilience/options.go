@@ -0,0 +1,196 @@
+package resilience
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Duration JSON中使用字符串表示的时间，如 "100ms"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"100ms\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Policy 服务和方法的容错策略，配置了hedging时不使用retry
+type Policy struct {
+	// Service 目标服务名，为空时匹配所有服务
+	Service string `json:"service"`
+	// Method gRPC完整方法名，如 /user.User/Get，以*结尾时按前缀匹配，为空时匹配所有方法
+	Method string `json:"method"`
+	// Timeout 每次请求的超时时间，为0时只使用调用方的超时
+	Timeout Duration       `json:"timeout"`
+	Retry   *RetryPolicy   `json:"retry"`
+	Hedging *HedgingPolicy `json:"hedging"`
+	Breaker *BreakerPolicy `json:"breaker"`
+}
+
+// RetryPolicy 失败后按退避时间重试
+type RetryPolicy struct {
+	// MaxAttempts 最多请求次数，包括第一次请求，默认3
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	// Codes 可以重试的错误码，默认UNAVAILABLE
+	Codes []codes.Code `json:"codes"`
+}
+
+// HedgingPolicy 对冲请求，只能用于幂等方法
+// 第一个请求Delay后还没有返回时发起下一个请求，使用最先成功的结果
+type HedgingPolicy struct {
+	// MaxAttempts 最多请求次数，包括第一次请求，默认2
+	MaxAttempts int      `json:"max_attempts"`
+	Delay       Duration `json:"delay"`
+	// Codes 非致命错误码，返回这些错误时立即发起下一个请求，其他错误直接返回，默认UNAVAILABLE
+	Codes []codes.Code `json:"codes"`
+}
+
+// BreakerPolicy 熔断器，Window内请求数达到MinRequests并且错误率达到ErrorRatio时打开
+// 打开OpenTimeout后进入半开状态，允许HalfOpenRequests个请求，全部成功后关闭
+type BreakerPolicy struct {
+	Window           Duration `json:"window"`
+	MinRequests      int      `json:"min_requests"`
+	ErrorRatio       float64  `json:"error_ratio"`
+	OpenTimeout      Duration `json:"open_timeout"`
+	HalfOpenRequests int      `json:"half_open_requests"`
+	// Codes 计为失败的错误码，默认UNAVAILABLE,DEADLINE_EXCEEDED,INTERNAL,UNKNOWN,RESOURCE_EXHAUSTED
+	Codes []codes.Code `json:"codes"`
+}
+
+func (p *Policy) match(service, method string) bool {
+	if p.Service != "" && p.Service != service {
+		return false
+	}
+	if p.Method == "" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(p.Method, "*"); ok {
+		return strings.HasPrefix(method, prefix)
+	}
+	return p.Method == method
+}
+
+func (p *Policy) complete() error {
+	if p.Retry != nil {
+		r := p.Retry
+		r.MaxAttempts = defaultValue(r.MaxAttempts, 3)
+		r.InitialBackoff = defaultValue(r.InitialBackoff, Duration(100*time.Millisecond))
+		r.MaxBackoff = defaultValue(r.MaxBackoff, Duration(time.Second))
+		if len(r.Codes) == 0 {
+			r.Codes = []codes.Code{codes.Unavailable}
+		}
+	}
+	if p.Hedging != nil {
+		h := p.Hedging
+		h.MaxAttempts = defaultValue(h.MaxAttempts, 2)
+		h.Delay = defaultValue(h.Delay, Duration(100*time.Millisecond))
+		if len(h.Codes) == 0 {
+			h.Codes = []codes.Code{codes.Unavailable}
+		}
+	}
+	if p.Breaker != nil {
+		b := p.Breaker
+		b.Window = defaultValue(b.Window, Duration(10*time.Second))
+		b.MinRequests = defaultValue(b.MinRequests, 20)
+		b.ErrorRatio = defaultValue(b.ErrorRatio, 0.5)
+		b.OpenTimeout = defaultValue(b.OpenTimeout, Duration(5*time.Second))
+		b.HalfOpenRequests = defaultValue(b.HalfOpenRequests, 1)
+		if len(b.Codes) == 0 {
+			b.Codes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted}
+		}
+		if b.ErrorRatio > 1 {
+			return fmt.Errorf("breaker error_ratio must be between 0 and 1, got %v", b.ErrorRatio)
+		}
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", time.Duration(p.Timeout))
+	}
+	return nil
+}
+
+func defaultValue[T int | float64 | Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// ParsePolicies 解析JSON格式的容错策略
+func ParsePolicies(s string) ([]*Policy, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var policies []*Policy
+	if err := json.Unmarshal([]byte(s), &policies); err != nil {
+		return nil, fmt.Errorf("parse resilience policies error: %w", err)
+	}
+	for i := range policies {
+		if err := policies[i].complete(); err != nil {
+			return nil, fmt.Errorf("resilience policy %d: %w", i, err)
+		}
+	}
+	return policies, nil
+}
+
+type config struct {
+	policies           []*Policy
+	budgetRatio        float64
+	budgetMinPerSecond float64
+}
+
+func (c *config) match(service, method string) *Policy {
+	for _, p := range c.policies {
+		if p.match(service, method) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Options 客户端容错参数，通过 Retrofit 在运行时更新
+type Options struct {
+	Policies           string  `flag:"policies" default:"" usage:"容错策略，JSON数组，按顺序匹配服务和方法，如：[{\"service\":\"user\",\"method\":\"/user.User/Get*\",\"retry\":{\"max_attempts\":3}}]"`
+	BudgetRatio        float64 `flag:"budget_ratio" default:"0.1" usage:"重试预算，10秒内重试和对冲请求数不超过请求数的比例"`
+	BudgetMinPerSecond float64 `flag:"budget_min_per_second" default:"10" usage:"请求数较少时每秒允许的最少重试数"`
+
+	current atomic.Pointer[config]
+}
+
+// Retrofit 重新解析容错策略，已经创建的拦截器立即生效，策略错误时保留原来的策略
+func (o *Options) Retrofit() error {
+	policies, err := ParsePolicies(o.Policies)
+	if err != nil {
+		return err
+	}
+	o.current.Store(&config{
+		policies:           policies,
+		budgetRatio:        o.BudgetRatio,
+		budgetMinPerSecond: o.BudgetMinPerSecond,
+	})
+	return nil
+}
+
+func (o *Options) load() *config {
+	if c := o.current.Load(); c != nil {
+		return c
+	}
+	if err := o.Retrofit(); err != nil {
+		logger.Warn("resilience policies error, policies disabled", "error", err)
+		o.current.CompareAndSwap(nil, &config{budgetRatio: o.BudgetRatio, budgetMinPerSecond: o.BudgetMinPerSecond})
+	}
+	return o.current.Load()
+}
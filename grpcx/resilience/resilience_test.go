@@ -0,0 +1,165 @@
+package resilience
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newOptions(t *testing.T, policies string) *Options {
+	o := &Options{Policies: policies, BudgetRatio: 0.1, BudgetMinPerSecond: 10}
+	if err := o.Retrofit(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// failingInvoker 前failures次请求返回code，之后成功
+func failingInvoker(calls *int32, failures int32, code codes.Code) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(calls, 1) <= failures {
+			return status.Error(code, "failed")
+		}
+		reply.(*wrapperspb.StringValue).Value = "ok"
+		return nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	o := newOptions(t, `[{"service":"user","method":"/user.User/*","retry":{"max_attempts":3,"initial_backoff":"1ms"}}]`)
+	interceptor := o.UnaryClientInterceptor("user")
+
+	var calls int32
+	reply := &wrapperspb.StringValue{}
+	if err := interceptor(context.Background(), "/user.User/Get", nil, reply, nil, failingInvoker(&calls, 2, codes.Unavailable)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || reply.Value != "ok" {
+		t.Fatalf("calls=%d reply=%q", calls, reply.Value)
+	}
+
+	// 不可重试的错误码
+	calls = 0
+	err := interceptor(context.Background(), "/user.User/Get", nil, reply, nil, failingInvoker(&calls, 2, codes.InvalidArgument))
+	if status.Code(err) != codes.InvalidArgument || calls != 1 {
+		t.Fatalf("calls=%d err=%v", calls, err)
+	}
+
+	// 不匹配的方法不重试
+	calls = 0
+	interceptor(context.Background(), "/order.Order/Get", nil, reply, nil, failingInvoker(&calls, 2, codes.Unavailable))
+	if calls != 1 {
+		t.Fatalf("unmatched method retried: calls=%d", calls)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	o := newOptions(t, `[{"retry":{"max_attempts":5,"initial_backoff":"1ms"}}]`)
+	o.BudgetRatio, o.BudgetMinPerSecond = 0, 0.2
+	if err := o.Retrofit(); err != nil {
+		t.Fatal(err)
+	}
+	interceptor := o.UnaryClientInterceptor("user")
+	var calls int32
+	interceptor(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, failingInvoker(&calls, 10, codes.Unavailable))
+	// 10秒内最多2次重试
+	if calls != 3 {
+		t.Fatalf("calls=%d, want 3", calls)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	o := newOptions(t, `[{"breaker":{"min_requests":4,"error_ratio":0.5,"open_timeout":"20ms"}}]`)
+	interceptor := o.UnaryClientInterceptor("user")
+	var calls int32
+	failing := failingInvoker(&calls, 4, codes.Unavailable)
+	for i := 0; i < 4; i++ {
+		interceptor(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, failing)
+	}
+	err := interceptor(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, failing)
+	if err != ErrBreakerOpen || calls != 4 {
+		t.Fatalf("breaker not open: calls=%d err=%v", calls, err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	// 半开状态的请求成功后关闭
+	if err := interceptor(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, failing); err != nil {
+		t.Fatal(err)
+	}
+	if err := interceptor(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, failing); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	o := newOptions(t, `[{"hedging":{"max_attempts":2,"delay":"10ms"}}]`)
+	interceptor := o.UnaryClientInterceptor("user")
+
+	var calls int32
+	// 第一个请求阻塞到被取消，第二个请求立即返回
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		reply.(*wrapperspb.StringValue).Value = "hedged"
+		return nil
+	}
+	reply := &wrapperspb.StringValue{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := interceptor(ctx, "/user.User/Get", nil, reply, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(reply, wrapperspb.String("hedged")) || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("calls=%d reply=%v", calls, reply)
+	}
+}
+
+func TestHedgingBreaker(t *testing.T) {
+	o := newOptions(t, `[{"hedging":{"max_attempts":2,"delay":"10ms"},"breaker":{"min_requests":4}}]`)
+	tg := &target{opts: o, service: "user"}
+
+	var calls int32
+	cancelled := make(chan struct{})
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			defer close(cancelled)
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return nil
+	}
+	if err := tg.intercept(context.Background(), "/user.User/Get", nil, &wrapperspb.StringValue{}, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	<-cancelled
+	time.Sleep(10 * time.Millisecond)
+	// 被hedge取消的请求不计入熔断统计
+	p := o.load().match("user", "/user.User/Get")
+	b := tg.breaker("/user.User/Get")
+	b.mu.Lock()
+	c := b.window.sum(time.Now(), time.Duration(p.Breaker.Window))
+	b.mu.Unlock()
+	if c.total != 1 || c.hits != 0 {
+		t.Fatalf("unexpected breaker counts %+v", c)
+	}
+}
+
+func TestRetrofitKeepsPolicies(t *testing.T) {
+	o := newOptions(t, `[{"retry":{}}]`)
+	o.Policies = "[{"
+	if err := o.Retrofit(); err == nil {
+		t.Fatal("expected error for invalid policies")
+	}
+	if p := o.load().match("user", "/user.User/Get"); p == nil || p.Retry.MaxAttempts != 3 {
+		t.Fatalf("policies not kept: %+v", p)
+	}
+}
@@ -1,39 +1,206 @@
 package tracing
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/daemtri/begonia/logx"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	stdout "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var log = logx.GetLogger("grpcx/tracing")
 
 type Factory struct {
-	Endpoint string `flag:"endpoint" default:"http://localhost:14268/api/traces" usage:"jaeger 服务地址"`
-	Exporter string `flag:"exporter" default:"stdout" usage:"支持 stdout|jaeger"`
-	Sample   string `flag:"sample" default:"never" usage:"dynamic: 可选,always,never,dynamic"`
+	Endpoint string  `flag:"endpoint" default:"http://localhost:14268/api/traces" usage:"jaeger 服务地址"`
+	Exporter string  `flag:"exporter" default:"stdout" usage:"支持 stdout|jaeger|otlp|otlp-http，otlp使用gRPC协议，jaeger已废弃，建议使用otlp"`
+	Sample   string  `flag:"sample" default:"never" usage:"dynamic: 可选,always,never,dynamic，dynamic按rules采样，支持运行时变更"`
+	Ratio    float64 `flag:"ratio" default:"0" usage:"dynamic模式下没有匹配规则的根span采样比例"`
+	Rules    string  `flag:"rules" default:"" usage:"dynamic模式的采样规则，JSON数组，按顺序匹配，如：[{\"user_id\":\"10001\",\"ratio\":1}]"`
+
+	OTLP OTLPOptions `flag:"otlp"`
+	// Attributes 额外的resource属性
+	Attributes map[string]string `flag:"attributes" default:"" usage:"额外的resource属性，如：deployment.environment=prod,region=cn"`
+	Batch      BatchOptions      `flag:"batch"`
+	// ShutdownTimeout 退出时等待span导出的最长时间
+	ShutdownTimeout time.Duration `flag:"shutdown_timeout" default:"10s" usage:"退出时等待缓存的span导出的最长时间"`
 
 	ServiceNamespace  string
 	ServiceName       string
 	ServiceVersion    string
 	ServiceInstanceID string
+
+	mux      sync.Mutex
+	sampler  *Sampler
+	provider *sdktrace.TracerProvider
 }
 
-// NewTracerProvider 创建 TracerProvider
-func (th *Factory) NewTracerProvider(attributes ...attribute.KeyValue) (*sdktrace.TracerProvider, error) {
-	var exporter sdktrace.SpanExporter
-	var err error
+// OTLPOptions OTLP导出参数
+type OTLPOptions struct {
+	Endpoint string            `flag:"endpoint" default:"" usage:"OTLP collector地址，为空时gRPC使用localhost:4317，HTTP使用localhost:4318"`
+	Insecure bool              `flag:"insecure" default:"true" usage:"是否使用非加密连接"`
+	Headers  map[string]string `flag:"headers" default:"" usage:"发送给collector的header，如：authorization=token"`
+	Timeout  time.Duration     `flag:"timeout" default:"10s" usage:"导出请求超时时间"`
+}
+
+// BatchOptions span批量导出参数，为0时使用sdk默认值
+type BatchOptions struct {
+	Timeout       time.Duration `flag:"timeout" default:"5s" usage:"批量导出的最长等待时间"`
+	MaxExportSize int           `flag:"max_export_size" default:"512" usage:"每批导出的最大span数"`
+	MaxQueueSize  int           `flag:"max_queue_size" default:"2048" usage:"等待导出的最大span数，队列满时丢弃新的span"`
+	ExportTimeout time.Duration `flag:"export_timeout" default:"30s" usage:"每批导出的超时时间"`
+}
+
+func (o BatchOptions) options() []sdktrace.BatchSpanProcessorOption {
+	var opts []sdktrace.BatchSpanProcessorOption
+	if o.Timeout > 0 {
+		opts = append(opts, sdktrace.WithBatchTimeout(o.Timeout))
+	}
+	if o.MaxExportSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(o.MaxExportSize))
+	}
+	if o.MaxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(o.MaxQueueSize))
+	}
+	if o.ExportTimeout > 0 {
+		opts = append(opts, sdktrace.WithExportTimeout(o.ExportTimeout))
+	}
+	return opts
+}
 
+func (th *Factory) newExporter() (sdktrace.SpanExporter, error) {
 	switch th.Exporter {
 	case "jaeger":
-		exporter, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(th.Endpoint)))
+		return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(th.Endpoint)))
+	case "otlp", "otlp-grpc":
+		endpoint := th.OTLP.Endpoint
+		if endpoint == "" {
+			endpoint = "localhost:4317"
+		}
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithHeaders(th.OTLP.Headers),
+		}
+		if th.OTLP.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if th.OTLP.Timeout > 0 {
+			opts = append(opts, otlptracegrpc.WithTimeout(th.OTLP.Timeout))
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case "otlp-http":
+		endpoint := th.OTLP.Endpoint
+		if endpoint == "" {
+			endpoint = "localhost:4318"
+		}
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithHeaders(th.OTLP.Headers),
+		}
+		if th.OTLP.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if th.OTLP.Timeout > 0 {
+			opts = append(opts, otlptracehttp.WithTimeout(th.OTLP.Timeout))
+		}
+		return otlptracehttp.New(context.Background(), opts...)
 	default:
-		exporter, err = stdout.New(stdout.WithPrettyPrint())
+		return stdout.New(stdout.WithPrettyPrint())
+	}
+}
+
+// getSampler 返回共享的采样器，第一次调用时根据配置创建
+func (th *Factory) getSampler() (*Sampler, error) {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	return th.samplerLocked()
+}
+
+func (th *Factory) samplerLocked() (*Sampler, error) {
+	if th.sampler != nil {
+		return th.sampler, nil
+	}
+	rules, err := ParseSampleRules(th.Rules)
+	if err != nil {
+		return nil, err
+	}
+	th.sampler = NewSampler(th.Sample, th.Ratio, rules)
+	return th.sampler, nil
+}
+
+// Retrofit 配置变更后更新采样模式和规则，已经创建的TracerProvider立即生效
+// 规则错误时保留原来的规则
+func (th *Factory) Retrofit() error {
+	sampler, err := th.getSampler()
+	if err != nil {
+		return err
+	}
+	rules, err := ParseSampleRules(th.Rules)
+	if err != nil {
+		return fmt.Errorf("trace sample rules not updated: %w", err)
+	}
+	sampler.Update(th.Sample, th.Ratio, rules)
+	log.Info("采样规则已更新", "sample", th.Sample, "ratio", th.Ratio, "rules", len(rules))
+	return nil
+}
+
+// TracerProvider 返回进程共享的TracerProvider，第一次调用时创建并设置为全局TracerProvider
+// kind 作为 sgr.kind 属性添加到通过返回值创建的span上
+func (th *Factory) TracerProvider(kind string) (trace.TracerProvider, error) {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	if th.provider == nil {
+		sample, err := th.samplerLocked()
+		if err != nil {
+			return nil, err
+		}
+		tp, err := th.newTracerProvider(sample)
+		if err != nil {
+			return nil, err
+		}
+		th.provider = tp
+		otel.SetTracerProvider(tp)
+	}
+	return &kindTracerProvider{TracerProvider: th.provider, kind: KindKey.String(kind)}, nil
+}
+
+// Shutdown 导出缓存的span并关闭共享的TracerProvider，engine退出后调用
+func (th *Factory) Shutdown(ctx context.Context) error {
+	th.mux.Lock()
+	defer th.mux.Unlock()
+	if th.provider == nil {
+		return nil
 	}
+	if th.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, th.ShutdownTimeout)
+		defer cancel()
+	}
+	return th.provider.Shutdown(ctx)
+}
+
+// NewTracerProvider 创建独立的 TracerProvider，调用方负责Shutdown
+// 一般使用共享的 TracerProvider
+func (th *Factory) NewTracerProvider(attributes ...attribute.KeyValue) (*sdktrace.TracerProvider, error) {
+	sample, err := th.getSampler()
+	if err != nil {
+		return nil, err
+	}
+	return th.newTracerProvider(sample, attributes...)
+}
+
+func (th *Factory) newTracerProvider(sample sdktrace.Sampler, attributes ...attribute.KeyValue) (*sdktrace.TracerProvider, error) {
+	exporter, err := th.newExporter()
 	if err != nil {
 		return nil, err
 	}
@@ -45,17 +212,8 @@ func (th *Factory) NewTracerProvider(attributes ...attribute.KeyValue) (*sdktrac
 		semconv.ServiceNamespaceKey.String(th.ServiceNamespace),
 		semconv.ServiceVersionKey.String(th.ServiceVersion),
 	}...)
-
-	var sample sdktrace.Sampler
-	switch th.Sample {
-	case "always":
-		sample = sdktrace.AlwaysSample()
-	case "never":
-		sample = sdktrace.NeverSample()
-	case "dynamic":
-		sample = dynamicSample()
-	default:
-		sample = sdktrace.NeverSample()
+	for k, v := range th.Attributes {
+		attributes = append(attributes, attribute.String(k, v))
 	}
 
 	tp := sdktrace.NewTracerProvider(
@@ -63,7 +221,7 @@ func (th *Factory) NewTracerProvider(attributes ...attribute.KeyValue) (*sdktrac
 		sdktrace.WithResource(
 			resource.NewWithAttributes(semconv.SchemaURL, attributes...),
 		),
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithBatcher(exporter, th.Batch.options()...),
 	)
 	log.Debug("构建tracing", "config", th)
 	return tp, nil
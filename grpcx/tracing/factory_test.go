@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	spans := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "token" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		spans <- req
+	}))
+	defer server.Close()
+
+	f := &Factory{
+		Exporter:    "otlp-http",
+		Sample:      "always",
+		ServiceName: "app",
+		Attributes:  map[string]string{"deployment.environment": "test"},
+		OTLP: OTLPOptions{
+			Endpoint: strings.TrimPrefix(server.URL, "http://"),
+			Insecure: true,
+			Headers:  map[string]string{"Authorization": "token"},
+		},
+	}
+	tp, err := f.NewTracerProvider(attribute.String("sgr.kind", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "hello")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-spans
+	rs := req.ResourceSpans[0]
+	if name := rs.ScopeSpans[0].Spans[0].Name; name != "hello" {
+		t.Fatalf("unexpected span %s", name)
+	}
+	found := false
+	for _, attr := range rs.Resource.Attributes {
+		if attr.Key == "deployment.environment" && attr.Value.GetStringValue() == "test" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("resource attribute not exported: %v", rs.Resource.Attributes)
+	}
+}
+
+func TestSharedTracerProvider(t *testing.T) {
+	exported := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		exported <- req
+	}))
+	defer server.Close()
+
+	f := &Factory{
+		Exporter: "otlp-http",
+		Sample:   "always",
+		OTLP:     OTLPOptions{Endpoint: strings.TrimPrefix(server.URL, "http://"), Insecure: true},
+	}
+	server1, err := f.TracerProvider("runtime-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := f.TracerProvider("app-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span1 := server1.Tracer("test").Start(context.Background(), "server")
+	_, span2 := client.Tracer("test").Start(context.Background(), "client")
+	if span1.TracerProvider() != span2.TracerProvider() {
+		t.Fatal("tracer providers are not shared")
+	}
+	span1.End()
+	span2.End()
+	if err := f.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-exported
+	kinds := map[string]string{}
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				for _, attr := range span.Attributes {
+					if attr.Key == string(KindKey) {
+						kinds[span.Name] = attr.Value.GetStringValue()
+					}
+				}
+			}
+		}
+	}
+	if kinds["server"] != "runtime-server" || kinds["client"] != "app-client" {
+		t.Fatalf("unexpected span kinds %v", kinds)
+	}
+}
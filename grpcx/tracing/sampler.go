@@ -0,0 +1,233 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// MsgIDKey 路由span上的消息ID属性
+	MsgIDKey = attribute.Key("begonia.msgid")
+	// TenantKey 租户ID属性
+	TenantKey = attribute.Key("begonia.tenant")
+)
+
+// SampleRule 动态采样规则，所有条件都满足时匹配，条件为空时不限制
+type SampleRule struct {
+	// Service gRPC服务全名，如 begonia.Business
+	Service string `json:"service"`
+	// Method gRPC完整方法名，如 /begonia.Business/Dispatch，以*结尾时按前缀匹配
+	Method string `json:"method"`
+	// MsgID 路由消息ID，只在路由span上生效
+	MsgID int32 `json:"msgid"`
+	// UserID 用户ID，从gRPC metadata的user_id或span的enduser.id属性获取
+	UserID string `json:"user_id"`
+	// Tenant 租户ID，从gRPC metadata的tenant_id或span的begonia.tenant属性获取
+	Tenant string `json:"tenant"`
+	// Ratio 采样比例，0到1，按trace id计算，同一个trace在各个服务的结果一致
+	Ratio float64 `json:"ratio"`
+	// RateLimit 每秒最多开始采样的trace数，0表示不限制
+	RateLimit float64 `json:"rate_limit"`
+	// ParentBased 为true时有父span则使用父span的采样结果，否则规则优先于父span
+	ParentBased bool `json:"parent_based"`
+}
+
+type sampleRule struct {
+	SampleRule
+	ratio   sdktrace.Sampler
+	limiter *rate.Limiter
+}
+
+func (r *sampleRule) match(keys *sampleKeys) bool {
+	if r.Service != "" && r.Service != keys.service {
+		return false
+	}
+	if r.Method != "" {
+		if prefix, ok := strings.CutSuffix(r.Method, "*"); ok {
+			if !strings.HasPrefix(keys.method, prefix) {
+				return false
+			}
+		} else if r.Method != keys.method {
+			return false
+		}
+	}
+	if r.MsgID != 0 && r.MsgID != keys.msgID {
+		return false
+	}
+	if r.UserID != "" && r.UserID != keys.userID {
+		return false
+	}
+	if r.Tenant != "" && r.Tenant != keys.tenant {
+		return false
+	}
+	return true
+}
+
+func (r *sampleRule) sample(p sdktrace.SamplingParameters, parentSampled bool) sdktrace.SamplingDecision {
+	if r.ratio.ShouldSample(p).Decision != sdktrace.RecordAndSample {
+		return sdktrace.Drop
+	}
+	// 父span已经采样时属于同一个trace，不计入限流
+	if parentSampled || r.limiter == nil || r.limiter.Allow() {
+		return sdktrace.RecordAndSample
+	}
+	return sdktrace.Drop
+}
+
+// ParseSampleRules 解析JSON格式的采样规则
+func ParseSampleRules(s string) ([]SampleRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var rules []SampleRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, fmt.Errorf("parse sample rules error: %w", err)
+	}
+	for i := range rules {
+		if rules[i].Ratio < 0 || rules[i].Ratio > 1 {
+			return nil, fmt.Errorf("sample rule %d: ratio must be between 0 and 1, got %v", i, rules[i].Ratio)
+		}
+		if rules[i].RateLimit < 0 {
+			return nil, fmt.Errorf("sample rule %d: rate_limit must not be negative, got %v", i, rules[i].RateLimit)
+		}
+	}
+	return rules, nil
+}
+
+// sampleKeys 从span属性和gRPC metadata中提取的匹配条件
+type sampleKeys struct {
+	service string
+	method  string
+	msgID   int32
+	userID  string
+	tenant  string
+}
+
+func newSampleKeys(p sdktrace.SamplingParameters) *sampleKeys {
+	keys := &sampleKeys{}
+	var method string
+	for _, kv := range p.Attributes {
+		switch kv.Key {
+		case semconv.RPCServiceKey:
+			keys.service = kv.Value.AsString()
+		case semconv.RPCMethodKey:
+			method = kv.Value.AsString()
+		case MsgIDKey:
+			keys.msgID = int32(kv.Value.AsInt64())
+		case semconv.EnduserIDKey:
+			keys.userID = kv.Value.AsString()
+		case TenantKey:
+			keys.tenant = kv.Value.AsString()
+		}
+	}
+	if keys.service != "" && method != "" {
+		keys.method = "/" + keys.service + "/" + method
+	}
+	if md, ok := metadata.FromIncomingContext(p.ParentContext); ok {
+		if v := md.Get("user_id"); keys.userID == "" && len(v) > 0 {
+			keys.userID = v[0]
+		}
+		if v := md.Get("tenant_id"); keys.tenant == "" && len(v) > 0 {
+			keys.tenant = v[0]
+		}
+	}
+	return keys
+}
+
+type samplerState struct {
+	mode  string
+	root  sdktrace.Sampler
+	rules []*sampleRule
+}
+
+func (st *samplerState) decide(p sdktrace.SamplingParameters, psc trace.SpanContext) sdktrace.SamplingDecision {
+	if len(st.rules) > 0 {
+		keys := newSampleKeys(p)
+		for _, r := range st.rules {
+			if !r.match(keys) {
+				continue
+			}
+			if r.ParentBased && psc.IsValid() {
+				return parentDecision(psc)
+			}
+			return r.sample(p, psc.IsSampled())
+		}
+	}
+	if psc.IsValid() {
+		return parentDecision(psc)
+	}
+	return st.root.ShouldSample(p).Decision
+}
+
+func parentDecision(psc trace.SpanContext) sdktrace.SamplingDecision {
+	if psc.IsSampled() {
+		return sdktrace.RecordAndSample
+	}
+	return sdktrace.Drop
+}
+
+// Sampler 可以在运行时更新规则的采样器
+// 同一个Factory创建的所有TracerProvider共享一个Sampler
+//
+//	always: 全部采样
+//	never: 全部不采样
+//	dynamic: 按规则顺序匹配，第一个匹配的规则生效；没有匹配的规则时使用父span的结果，根span按ratio采样
+type Sampler struct {
+	state atomic.Pointer[samplerState]
+}
+
+// NewSampler 创建采样器
+func NewSampler(mode string, ratio float64, rules []SampleRule) *Sampler {
+	s := &Sampler{}
+	s.Update(mode, ratio, rules)
+	return s
+}
+
+// Update 更新采样模式和规则，立即对新创建的span生效，规则的限流状态会被重置
+func (s *Sampler) Update(mode string, ratio float64, rules []SampleRule) {
+	st := &samplerState{
+		mode:  mode,
+		root:  sdktrace.TraceIDRatioBased(ratio),
+		rules: make([]*sampleRule, 0, len(rules)),
+	}
+	for _, r := range rules {
+		sr := &sampleRule{SampleRule: r, ratio: sdktrace.TraceIDRatioBased(r.Ratio)}
+		if r.RateLimit > 0 {
+			sr.limiter = rate.NewLimiter(rate.Limit(r.RateLimit), max(int(r.RateLimit), 1))
+		}
+		st.rules = append(st.rules, sr)
+	}
+	s.state.Store(st)
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	st := s.state.Load()
+	var decision sdktrace.SamplingDecision
+	switch st.mode {
+	case "always":
+		decision = sdktrace.RecordAndSample
+	case "dynamic":
+		decision = st.decide(p, psc)
+	default:
+		decision = sdktrace.Drop
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: psc.TraceState(),
+	}
+}
+
+func (s *Sampler) Description() string {
+	st := s.state.Load()
+	return fmt.Sprintf("begonia{mode=%s,rules=%d}", st.mode, len(st.rules))
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func sampleParams(ctx context.Context, attrs ...attribute.KeyValue) sdktrace.SamplingParameters {
+	return sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Name:          "test",
+		Attributes:    attrs,
+	}
+}
+
+func parentContext(sampled bool) context.Context {
+	cfg := trace.SpanContextConfig{
+		TraceID: trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	}
+	if sampled {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(cfg))
+}
+
+func TestSamplerRules(t *testing.T) {
+	rules, err := ParseSampleRules(`[
+		{"user_id":"10001","ratio":1},
+		{"method":"/begonia.Business/*","ratio":1,"parent_based":true},
+		{"msgid":100,"ratio":0}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSampler("dynamic", 0, rules)
+	userCtx := metadata.NewIncomingContext(parentContext(false), metadata.Pairs("user_id", "10001"))
+	method := []attribute.KeyValue{semconv.RPCServiceKey.String("begonia.Business"), semconv.RPCMethodKey.String("Dispatch")}
+
+	cases := []struct {
+		name   string
+		params sdktrace.SamplingParameters
+		want   sdktrace.SamplingDecision
+	}{
+		{"user overrides parent", sampleParams(userCtx), sdktrace.RecordAndSample},
+		{"method root", sampleParams(context.Background(), method...), sdktrace.RecordAndSample},
+		{"method parent based", sampleParams(parentContext(false), method...), sdktrace.Drop},
+		{"msgid drops sampled parent", sampleParams(parentContext(true), MsgIDKey.Int(100)), sdktrace.Drop},
+		{"no rule follows parent", sampleParams(parentContext(true)), sdktrace.RecordAndSample},
+		{"no rule root uses ratio", sampleParams(context.Background()), sdktrace.Drop},
+	}
+	for _, c := range cases {
+		if got := s.ShouldSample(c.params).Decision; got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	s.Update("never", 0, rules)
+	if got := s.ShouldSample(sampleParams(userCtx)).Decision; got != sdktrace.Drop {
+		t.Errorf("never: got %v", got)
+	}
+}
+
+func TestSamplerRateLimit(t *testing.T) {
+	s := NewSampler("dynamic", 0, []SampleRule{{Tenant: "7", Ratio: 1, RateLimit: 2}})
+	p := sampleParams(context.Background(), TenantKey.String("7"))
+	sampled := 0
+	for i := 0; i < 10; i++ {
+		if s.ShouldSample(p).Decision == sdktrace.RecordAndSample {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Fatalf("sampled %d traces, want 2", sampled)
+	}
+	// 父span已采样的span不计入限流
+	if got := s.ShouldSample(sampleParams(parentContext(true), TenantKey.String("7"))).Decision; got != sdktrace.RecordAndSample {
+		t.Fatalf("sampled parent: got %v", got)
+	}
+}
+
+func TestFactoryRetrofit(t *testing.T) {
+	f := &Factory{Sample: "never"}
+	tp, err := f.NewTracerProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	f.Sample, f.Rules = "dynamic", `[{"user_id":"10001","ratio":1}]`
+	if err := f.Retrofit(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user_id", "10001"))
+	_, span := tp.Tracer("test").Start(ctx, "hello")
+	defer span.End()
+	if !span.SpanContext().IsSampled() {
+		t.Fatal("span not sampled after retrofit")
+	}
+
+	f.Rules = "[{"
+	if err := f.Retrofit(); err == nil {
+		t.Fatal("expected error for invalid rules")
+	}
+}
@@ -1,60 +1,55 @@
 package tracing
 
 import (
-	"encoding/binary"
-	"fmt"
+	"context"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// KindKey 区分span来源的属性，如 runtime-server、app-client
+const KindKey = attribute.Key("sgr.kind")
+
 func init() {
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	tp, err := (&Factory{}).NewTracerProvider()
-	if err != nil {
-		otel.SetTracerProvider(tp)
-	}
 }
 
-type Sampler struct {
-	traceIDUpperBound uint64
-	description       string
+// Tracer 返回ctx中span所属TracerProvider的Tracer，ctx中没有本地span时使用全局TracerProvider
+// 用于在gRPC请求中创建子span，保证子span和otelgrpc创建的span使用同一个TracerProvider导出
+func Tracer(ctx context.Context, name string) trace.Tracer {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() && !sc.IsRemote() {
+		return trace.SpanFromContext(ctx).TracerProvider().Tracer(name)
+	}
+	return otel.Tracer(name)
 }
 
-func dynamicSample() *Sampler {
-	var fraction float64 = 1
-
-	return &Sampler{
-		traceIDUpperBound: uint64(fraction * (1 << 63)),
-		description:       fmt.Sprintf("dynamicSample"),
+// EndSpan 记录错误并结束span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
+	span.End()
 }
 
-func (ts Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
-	psc := trace.SpanContextFromContext(p.ParentContext)
-	if !psc.IsRemote() {
-		return sdktrace.SamplingResult{
-			Decision:   sdktrace.Drop,
-			Tracestate: psc.TraceState(),
-		}
-	}
+// kindTracerProvider 共享同一个TracerProvider，在创建的span上添加kind属性
+type kindTracerProvider struct {
+	trace.TracerProvider
+	kind attribute.KeyValue
+}
 
-	x := binary.BigEndian.Uint64(p.TraceID[0:8]) >> 1
-	if x < ts.traceIDUpperBound {
-		return sdktrace.SamplingResult{
-			Decision:   sdktrace.RecordAndSample,
-			Tracestate: psc.TraceState(),
-		}
-	}
+func (p *kindTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return &kindTracer{Tracer: p.TracerProvider.Tracer(name, opts...), kind: p.kind}
+}
 
-	return sdktrace.SamplingResult{
-		Decision:   sdktrace.Drop,
-		Tracestate: psc.TraceState(),
-	}
+type kindTracer struct {
+	trace.Tracer
+	kind attribute.KeyValue
 }
 
-func (ts Sampler) Description() string {
-	return ts.description
+func (t *kindTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return t.Tracer.Start(ctx, spanName, append(opts[:len(opts):len(opts)], trace.WithAttributes(t.kind))...)
 }
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcServerHandled = Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc_server",
+		Name:      "handled_total",
+		Help:      "gRPC服务端处理完成的请求数",
+	}, []string{"method", "code"}))
+	grpcServerHandling = Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc_server",
+		Name:      "handling_seconds",
+		Help:      "gRPC服务端处理请求的耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"}))
+	grpcClientHandled = Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc_client",
+		Name:      "handled_total",
+		Help:      "gRPC客户端完成的请求数，stream请求在建立stream时统计",
+	}, []string{"method", "code"}))
+	grpcClientHandling = Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc_client",
+		Name:      "handling_seconds",
+		Help:      "gRPC客户端请求的耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"}))
+)
+
+func observeGrpc(handled *prometheus.CounterVec, handling *prometheus.HistogramVec, method string, start time.Time, err error) {
+	handled.WithLabelValues(method, status.Code(err).String()).Inc()
+	handling.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// UnaryServerInterceptor 统计gRPC服务端unary请求
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeGrpc(grpcServerHandled, grpcServerHandling, info.FullMethod, start, err)
+	return resp, err
+}
+
+// StreamServerInterceptor 统计gRPC服务端stream请求，耗时为整个stream的时长
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeGrpc(grpcServerHandled, grpcServerHandling, info.FullMethod, start, err)
+	return err
+}
+
+// UnaryClientInterceptor 统计gRPC客户端unary请求
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	observeGrpc(grpcClientHandled, grpcClientHandling, method, start, err)
+	return err
+}
+
+// StreamClientInterceptor 统计gRPC客户端建立stream的结果和耗时
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	observeGrpc(grpcClientHandled, grpcClientHandling, method, start, err)
+	return cs, err
+}
@@ -0,0 +1,74 @@
+// Package metrics 提供prometheus监控指标，指标注册到独立的Registry，由debug server通过/metrics暴露
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace 所有内置指标的前缀
+const Namespace = "begonia"
+
+var (
+	registry = prometheus.NewRegistry()
+	// instanceSeq 生成RegisterInstance的client标签
+	instanceSeq atomic.Uint64
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Registerer 返回指标注册器
+func Registerer() prometheus.Registerer {
+	return registry
+}
+
+// Gatherer 返回指标采集器
+func Gatherer() prometheus.Gatherer {
+	return registry
+}
+
+// Handler 返回/metrics的http处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Register 注册collector，已经注册过相同的collector时返回已注册的，其他错误时panic
+// 只用于包级别共享的指标，每个客户端实例的collector使用RegisterInstance
+func Register[T prometheus.Collector](c T) T {
+	if err := registry.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Unregister 注销collector
+func Unregister(c prometheus.Collector) bool {
+	return registry.Unregister(c)
+}
+
+// RegisterInstance 注册每个客户端实例的collector，如连接池状态，返回注销函数，客户端关闭时调用
+// 指标添加进程内唯一的client标签，相同地址的多个实例不会冲突，注册失败时panic
+func RegisterInstance(c prometheus.Collector) (unregister func()) {
+	r := prometheus.WrapRegistererWith(prometheus.Labels{"client": strconv.FormatUint(instanceSeq.Add(1), 10)}, registry)
+	r.MustRegister(c)
+	return func() {
+		r.Unregister(c)
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestModule(t *testing.T) {
+	c := ForModule("shop").NewCounter("orders_total", "订单数", "status")
+	if ForModule("shop").NewCounter("orders_total", "订单数", "status") != c {
+		t.Fatal("expected the registered counter")
+	}
+	c.WithLabelValues("paid").Inc()
+	ForModule("user").NewCounter("orders_total", "订单数", "status").WithLabelValues("paid").Add(2)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	_, _ = UnaryServerInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`begonia_module_orders_total{module="shop",status="paid"} 1`,
+		`begonia_module_orders_total{module="user",status="paid"} 2`,
+		`begonia_grpc_server_handled_total{code="NotFound",method="/test.Service/Method"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %s", want)
+		}
+	}
+}
+
+func TestRegisterInstance(t *testing.T) {
+	newCollector := func(v float64) prometheus.Collector {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_pool_connections", ConstLabels: prometheus.Labels{"addr": "127.0.0.1"}})
+		g.Set(v)
+		return g
+	}
+	// 相同地址的两个实例都要被采集
+	unregister1 := RegisterInstance(newCollector(1))
+	unregister2 := RegisterInstance(newCollector(2))
+	defer unregister2()
+	count := func() int {
+		mfs, err := Gatherer().Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "test_pool_connections" {
+				return len(mf.GetMetric())
+			}
+		}
+		return 0
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("expected 2 instances, got %d", n)
+	}
+	unregister1()
+	if n := count(); n != 1 {
+		t.Fatalf("expected 1 instance after unregister, got %d", n)
+	}
+}
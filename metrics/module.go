@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Module 模块自定义的监控指标，指标名称以begonia_module_开头，并带有module标签
+type Module struct {
+	name string
+}
+
+// ForModule 返回模块的监控指标
+func ForModule(name string) *Module {
+	return &Module{name: name}
+}
+
+func (m *Module) labels() prometheus.Labels {
+	return prometheus.Labels{"module": m.name}
+}
+
+// NewCounter 注册计数器，同一个模块多次注册同名的计数器时返回同一个
+func (m *Module) NewCounter(name, help string, labels ...string) *prometheus.CounterVec {
+	return Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   Namespace,
+		Subsystem:   "module",
+		Name:        name,
+		Help:        help,
+		ConstLabels: m.labels(),
+	}, labels))
+}
+
+// NewGauge 注册仪表盘
+func (m *Module) NewGauge(name, help string, labels ...string) *prometheus.GaugeVec {
+	return Register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   Namespace,
+		Subsystem:   "module",
+		Name:        name,
+		Help:        help,
+		ConstLabels: m.labels(),
+	}, labels))
+}
+
+// NewHistogram 注册直方图，buckets为空时使用prometheus.DefBuckets
+func (m *Module) NewHistogram(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	return Register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   Namespace,
+		Subsystem:   "module",
+		Name:        name,
+		Help:        help,
+		Buckets:     buckets,
+		ConstLabels: m.labels(),
+	}, labels))
+}
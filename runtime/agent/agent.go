@@ -2,13 +2,13 @@ package agent
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/daemtri/begonia/logx"
-	"github.com/daemtri/begonia/pkg/chanpubsub"
-	"github.com/daemtri/begonia/pkg/syncx"
 	"github.com/daemtri/begonia/runtime/component"
 )
 
@@ -16,99 +16,283 @@ var (
 	logger = logx.GetLogger("runtime/agent")
 )
 
+type Options struct {
+	MinBackoff time.Duration `flag:"min_backoff" default:"100ms" usage:"watch出错后重试的最小退避时间"`
+	MaxBackoff time.Duration `flag:"max_backoff" default:"30s" usage:"watch出错后重试的最大退避时间"`
+}
+
+func (o *Options) ValidateFlags() error {
+	if o.MinBackoff <= 0 || o.MaxBackoff < o.MinBackoff {
+		return fmt.Errorf("invalid discovery agent backoff: min=%s max=%s", o.MinBackoff, o.MaxBackoff)
+	}
+	return nil
+}
+
+// DiscoveryAgent 包装component.Discovery，每个服务名只watch一次，Browse、Lookup和Watch都从缓存读取
+// watch出错后按指数退避重新watch，期间继续使用最后一次成功的结果
 type DiscoveryAgent struct {
 	component.Discovery
 
-	cache syncx.Map[string, *component.Service]
-	queue *chanpubsub.Broker[*component.Service]
-	lock  sync.Mutex
+	opts    Options
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mux     sync.Mutex
+	watches map[string]*serviceWatch
 }
 
-func NewDiscoveryAgent(d component.Discovery) *DiscoveryAgent {
+func NewDiscoveryAgent(d component.Discovery, opts Options) *DiscoveryAgent {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &DiscoveryAgent{
 		Discovery: d,
-		queue:     chanpubsub.NewBroker[*component.Service](),
+		opts:      opts,
+		ctx:       ctx,
+		cancel:    cancel,
+		watches:   make(map[string]*serviceWatch),
 	}
 }
 
+// serviceWatch 一个服务的watch和缓存
+type serviceWatch struct {
+	name  string
+	ready chan struct{}
+	err   error
+
+	mux         sync.RWMutex
+	current     *component.Service
+	version     uint64
+	updatedAt   time.Time
+	errors      int
+	lastError   string
+	subscribers map[*subscriber]struct{}
+}
+
+// ServiceSnapshot 服务缓存的快照，用于调试
+type ServiceSnapshot struct {
+	Service     *component.Service `json:"service"`
+	Version     uint64             `json:"version"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	Subscribers int                `json:"subscribers"`
+	Errors      int                `json:"errors"`
+	LastError   string             `json:"last_error,omitempty"`
+}
+
 // Lookup 查询指定id和name的ServiceEntry
-func (da *DiscoveryAgent) Lookup(ctx context.Context, name, id string) (component.ServiceEntry, error) {
-	ds, ok := da.cache.Load(name)
-	if !ok {
-		var err error
-		ds, err = da.startWatch(name)
-		if err != nil {
-			return component.ServiceEntry{}, err
-		}
+func (da *DiscoveryAgent) Lookup(ctx context.Context, name, id string) (*component.ServiceEntry, error) {
+	s, err := da.Browse(ctx, name)
+	if err != nil {
+		return nil, err
 	}
-	for i := range ds.Entries {
-		if ds.Entries[i].ID == id {
-			return ds.Entries[i], nil
+	for i := range s.Entries {
+		if s.Entries[i].ID == id {
+			return &s.Entries[i], nil
 		}
 	}
-	return component.ServiceEntry{}, errors.New("not found")
+	return nil, fmt.Errorf("service %s/%s not found", name, id)
 }
 
 // Browse 查询指定name的所有ServiceEntry
 func (da *DiscoveryAgent) Browse(ctx context.Context, name string) (*component.Service, error) {
-	ds, ok := da.cache.Load(name)
-	if !ok {
-		var err error
-		ds, err = da.startWatch(name)
-		if err != nil {
-			return nil, err
+	sw, err := da.startWatch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sw.mux.RLock()
+	defer sw.mux.RUnlock()
+	return sw.current, nil
+}
+
+// Watch 订阅服务变化，同一个服务的多个订阅共享一个底层watch
+func (da *DiscoveryAgent) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	ctx, cancel := context.WithCancel(ctx)
+	return &subscriber{
+		agent:   da,
+		name:    name,
+		ctx:     ctx,
+		cancel:  cancel,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Snapshot 返回所有已缓存服务的快照
+func (da *DiscoveryAgent) Snapshot() map[string]ServiceSnapshot {
+	da.mux.Lock()
+	watches := make([]*serviceWatch, 0, len(da.watches))
+	for _, sw := range da.watches {
+		watches = append(watches, sw)
+	}
+	da.mux.Unlock()
+
+	ret := make(map[string]ServiceSnapshot, len(watches))
+	for _, sw := range watches {
+		sw.mux.RLock()
+		if sw.current != nil {
+			ret[sw.name] = ServiceSnapshot{
+				Service:     sw.current,
+				Version:     sw.version,
+				UpdatedAt:   sw.updatedAt,
+				Subscribers: len(sw.subscribers),
+				Errors:      sw.errors,
+				LastError:   sw.lastError,
+			}
 		}
+		sw.mux.RUnlock()
 	}
-	logger.Debug("DiscoveryAgent Browse", "name", name, "entries", ds)
-	return ds, nil
+	return ret
+}
+
+// ServeHTTP 以json格式输出Snapshot
+func (da *DiscoveryAgent) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(da.Snapshot())
+}
+
+// Close 停止所有watch
+func (da *DiscoveryAgent) Close() {
+	da.cancel()
 }
 
-func (da *DiscoveryAgent) startWatch(name string) (*component.Service, error) {
-	da.lock.Lock()
-	defer da.lock.Unlock()
-	ses2, ok := da.cache.Load(name)
-	if ok {
-		return ses2, nil
+// startWatch 返回服务的watch，不存在时启动并等待第一次结果
+// 第一次watch失败时返回错误，下次调用会重新尝试
+func (da *DiscoveryAgent) startWatch(ctx context.Context, name string) (*serviceWatch, error) {
+	da.mux.Lock()
+	sw, ok := da.watches[name]
+	if !ok {
+		sw = &serviceWatch{
+			name:        name,
+			ready:       make(chan struct{}),
+			subscribers: make(map[*subscriber]struct{}),
+		}
+		da.watches[name] = sw
+		go da.run(sw)
 	}
-	iter := da.Discovery.Watch(context.TODO(), name)
-	ses1, err := iter.Next()
-	if err != nil {
-		return nil, fmt.Errorf("discovery watch  error %s", err)
+	da.mux.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-sw.ready:
 	}
-	sender := da.queue.Topic(name)
-	da.cache.Store(name, ses1)
-	logger.Debug("DiscoveryAgent service found", "name", name, "entries", ses1)
-	go func() {
+	if sw.err != nil {
+		return nil, sw.err
+	}
+	return sw, nil
+}
+
+func (da *DiscoveryAgent) run(sw *serviceWatch) {
+	backoff := da.opts.MinBackoff
+	for {
+		stream := da.Discovery.Watch(da.ctx, sw.name)
 		for {
-			ses, err := iter.Next()
+			s, err := stream.Next()
 			if err != nil {
-				logger.Warn("DiscoveryAgent service next error", "name", name, "error", err)
-				continue
+				stream.Stop()
+				if da.ctx.Err() != nil {
+					return
+				}
+				if !da.handleError(sw, err) {
+					return
+				}
+				break
 			}
-			da.cache.Store(name, ses)
-			sender <- ses
-			logger.Debug("DiscoveryAgent service changed", "name", name, "entries", ses)
+			backoff = da.opts.MinBackoff
+			da.update(sw, s)
 		}
-	}()
-	return ses1, nil
+		logger.Warn("discovery watch error, retry later", "name", sw.name, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-da.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, da.opts.MaxBackoff)
+	}
 }
 
-func (da *DiscoveryAgent) Watch(ctx context.Context, name string, ch chan<- *component.Service) error {
-	ses, err := da.startWatch(name)
-	if err != nil {
-		return err
+// handleError 记录watch错误，返回false表示第一次watch就失败，放弃该watch
+func (da *DiscoveryAgent) handleError(sw *serviceWatch, err error) bool {
+	sw.mux.Lock()
+	first := sw.current == nil
+	sw.errors++
+	sw.lastError = err.Error()
+	sw.mux.Unlock()
+	if !first {
+		return true
+	}
+	da.mux.Lock()
+	delete(da.watches, sw.name)
+	da.mux.Unlock()
+	sw.err = fmt.Errorf("discovery watch %s error: %w", sw.name, err)
+	close(sw.ready)
+	return false
+}
+
+func (da *DiscoveryAgent) update(sw *serviceWatch, s *component.Service) {
+	sw.mux.Lock()
+	first := sw.current == nil
+	sw.current = s
+	sw.version++
+	sw.updatedAt = time.Now()
+	for sub := range sw.subscribers {
+		select {
+		case sub.changed <- struct{}{}:
+		default:
+		}
 	}
-	topic := da.queue.Topic(name)
-	topic <- ses
+	sw.mux.Unlock()
+	if first {
+		close(sw.ready)
+	}
+	logger.Debug("DiscoveryAgent service changed", "name", sw.name, "entries", s.Entries)
+}
 
-	updates, cancel := da.queue.Subscribe(name)
+// subscriber 从缓存读取服务变化，只返回最新的结果
+type subscriber struct {
+	agent   *DiscoveryAgent
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed chan struct{}
+
+	sw      *serviceWatch
+	version uint64
+}
+
+func (s *subscriber) Next() (*component.Service, error) {
+	if s.sw == nil {
+		sw, err := s.agent.startWatch(s.ctx, s.name)
+		if err != nil {
+			return nil, err
+		}
+		sw.mux.Lock()
+		sw.subscribers[s] = struct{}{}
+		sw.mux.Unlock()
+		s.sw = sw
+	}
 	for {
+		s.sw.mux.RLock()
+		current, version := s.sw.current, s.sw.version
+		s.sw.mux.RUnlock()
+		if version != s.version {
+			s.version = version
+			return current, nil
+		}
 		select {
-		case s := <-updates:
-			ch <- s
-		case <-ctx.Done():
-			cancel()
-			return nil
+		case <-s.ctx.Done():
+			s.sw.mux.Lock()
+			delete(s.sw.subscribers, s)
+			s.sw.mux.Unlock()
+			return nil, s.ctx.Err()
+		case <-s.changed:
 		}
 	}
 }
+
+// Stop 取消订阅，阻塞中的Next返回后从订阅列表中移除
+func (s *subscriber) Stop() {
+	s.cancel()
+}
+
+var _ component.Discovery = (*DiscoveryAgent)(nil)
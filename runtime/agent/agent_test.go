@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+type fakeDiscovery struct {
+	component.Discovery
+
+	watches atomic.Int32
+	mux     sync.Mutex
+	streams []*component.ChanStream[*component.Service]
+}
+
+func (f *fakeDiscovery) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	f.watches.Add(1)
+	s := component.NewChanStream[*component.Service](ctx)
+	f.mux.Lock()
+	f.streams = append(f.streams, s)
+	f.mux.Unlock()
+	return s
+}
+
+func (f *fakeDiscovery) latest() *component.ChanStream[*component.Service] {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.streams[len(f.streams)-1]
+}
+
+func service(ids ...string) *component.Service {
+	s := &component.Service{}
+	for _, id := range ids {
+		s.Entries = append(s.Entries, component.ServiceEntry{ID: id, Name: "app"})
+	}
+	return s
+}
+
+func TestDiscoveryAgent(t *testing.T) {
+	fd := &fakeDiscovery{}
+	da := NewDiscoveryAgent(fd, Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	defer da.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s1, s2 := da.Watch(ctx, "app"), da.Watch(ctx, "app")
+	defer s1.Stop()
+	defer s2.Stop()
+	go func() {
+		for fd.watches.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		fd.latest().Send(service("1"), nil)
+	}()
+	for _, s := range []component.Stream[*component.Service]{s1, s2} {
+		svc, err := s.Next()
+		if err != nil || len(svc.Entries) != 1 {
+			t.Fatalf("unexpected service %+v %v", svc, err)
+		}
+	}
+	if _, err := da.Lookup(ctx, "app", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := fd.watches.Load(); n != 1 {
+		t.Fatalf("expected 1 underlying watch, got %d", n)
+	}
+
+	// watch出错后重新watch，缓存继续可用
+	fd.latest().Send(nil, errors.New("broken"))
+	for fd.watches.Load() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if svc, err := da.Browse(ctx, "app"); err != nil || len(svc.Entries) != 1 {
+		t.Fatalf("unexpected service %+v %v", svc, err)
+	}
+	fd.latest().Send(service("1", "2"), nil)
+	svc, err := s1.Next()
+	if err != nil || len(svc.Entries) != 2 {
+		t.Fatalf("unexpected service %+v %v", svc, err)
+	}
+	snapshot := da.Snapshot()["app"]
+	if snapshot.Errors != 1 || snapshot.Version != 2 || snapshot.Subscribers != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+}
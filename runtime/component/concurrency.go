@@ -2,13 +2,17 @@ package component
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrLocked TryLock时锁已被其他会话持有
+var ErrLocked = errors.New("mutex: locked by another session")
+
 type Mutex interface {
 	// TryLock locks the mutex if not already locked by another session.
-	// If lock is held by another session, return immediately after attempting necessary cleanup
+	// If lock is held by another session, return ErrLocked immediately after attempting necessary cleanup
 	// The ctx argument is used for the sending/receiving Txn RPC.
 	TryLock(ctx context.Context) error
 
@@ -18,6 +22,10 @@ type Mutex interface {
 
 	// Unlock 解锁
 	Unlock(ctx context.Context) error
+
+	// Fence 返回最近一次加锁成功时获得的fencing token，同一个锁的token单调递增
+	// 持有者在写入外部存储时携带token，存储方拒绝较小的token即可避免锁过期后的并发写入
+	Fence() int64
 }
 
 // Session represents a lease kept alive for the lifetime of a client.
@@ -25,6 +33,10 @@ type Mutex interface {
 type Session interface {
 	NewMutex(pfx string) Mutex
 	NewLocker(pfx string) sync.Locker
+	// Done 会话过期或关闭后返回的channel会被关闭，会话持有的锁也随之失效
+	Done() <-chan struct{}
+	// Close 关闭会话并释放会话持有的所有锁
+	Close() error
 }
 
 type Concurrency interface {
@@ -2,6 +2,11 @@ package component
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"sigs.k8s.io/yaml"
 )
 
 type configDecoder struct {
@@ -16,6 +21,20 @@ func NewConfigDecoder(raw []byte, decode func(raw []byte, x any) error) ConfigDe
 	}
 }
 
+// NewConfigDecoderByName 根据配置名的后缀选择解码方式：.json、.toml，其他按yaml解码
+func NewConfigDecoderByName(name string, raw []byte) ConfigDecoder {
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		return NewConfigDecoder(raw, json.Unmarshal)
+	case strings.HasSuffix(name, ".toml"):
+		return NewConfigDecoder(raw, toml.Unmarshal)
+	default:
+		return NewConfigDecoder(raw, func(raw []byte, x any) error {
+			return yaml.Unmarshal(raw, x)
+		})
+	}
+}
+
 func (cd configDecoder) Raw() []byte {
 	return cd.raw
 }
@@ -20,6 +20,8 @@ type Discovery interface {
 
 	// Register 注册service，Register只能被调用一次
 	Register(ctx context.Context, service ServiceEntry) error
+	// Deregister 注销service，注销后其他服务不再能发现该实例
+	Deregister(ctx context.Context, service ServiceEntry) error
 	// Lookup 查询指定id和name的ServiceEntry
 	Lookup(ctx context.Context, name, id string) (*ServiceEntry, error)
 	// Browse 查询指定name的所有ServiceEntry
@@ -0,0 +1,54 @@
+package etcd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/daemtri/begonia/driver/etcd"
+	"github.com/daemtri/begonia/runtime"
+)
+
+const Name = "etcd"
+
+// clientOptions etcd驱动通用的连接参数
+type clientOptions struct {
+	endpoints   string
+	dialTimeout time.Duration
+	username    string
+	password    string
+	prefix      string
+}
+
+func (o *clientOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.endpoints, "endpoints", "127.0.0.1:2379", "etcd地址,多个地址用逗号分隔")
+	fs.DurationVar(&o.dialTimeout, "dial_timeout", 5*time.Second, "etcd连接超时时间")
+	fs.StringVar(&o.username, "username", "", "etcd username")
+	fs.StringVar(&o.password, "password", "", "etcd password")
+	fs.StringVar(&o.prefix, "prefix", "/begonia", "etcd key前缀")
+}
+
+func (o *clientOptions) ValidateFlags() error {
+	if strings.TrimSpace(o.endpoints) == "" {
+		return fmt.Errorf("etcd endpoints is empty")
+	}
+	return nil
+}
+
+func (o *clientOptions) newClient() (*etcd.Client, error) {
+	opts := &etcd.Options{
+		Endpoints:   strings.Split(o.endpoints, ","),
+		DialTimeout: o.dialTimeout,
+		Username:    o.username,
+		Password:    o.password,
+	}
+	return opts.Build(context.Background())
+}
+
+// namespacePrefix 返回当前命名空间下的key前缀，形如：/begonia/default
+func (o *clientOptions) namespacePrefix() string {
+	return path.Join("/", o.prefix, runtime.GetNamespace())
+}
@@ -0,0 +1,101 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/driver/etcd"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+func init() {
+	component.Register[component.Concurrency](Name, &ConcurrencyBootloader{})
+}
+
+type ConcurrencyBootloader struct {
+	clientOptions
+
+	instance *Concurrency
+}
+
+func (c *ConcurrencyBootloader) Boot(logger *logx.Logger) error {
+	client, err := c.newClient()
+	if err != nil {
+		return err
+	}
+	c.instance = NewConcurrency(client, c.namespacePrefix())
+	return nil
+}
+
+func (c *ConcurrencyBootloader) Retrofit() error {
+	return nil
+}
+
+func (c *ConcurrencyBootloader) Instance() component.Concurrency {
+	return c.instance
+}
+
+func (c *ConcurrencyBootloader) Destroy() error {
+	return c.instance.client.Close()
+}
+
+// Concurrency 基于etcd租约的会话和互斥锁，锁保存在 {prefix}/locks/{pfx}
+type Concurrency struct {
+	client *etcd.Client
+	prefix string
+}
+
+func NewConcurrency(client *etcd.Client, prefix string) *Concurrency {
+	return &Concurrency{client: client, prefix: prefix}
+}
+
+func (c *Concurrency) NewSession(ctx context.Context, ttl time.Duration) (component.Session, error) {
+	s, err := concurrency.NewSession(c.client.Client,
+		concurrency.WithTTL(max(int(ttl/time.Second), 1)),
+		concurrency.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session{Session: s, prefix: path.Join(c.prefix, "locks")}, nil
+}
+
+type session struct {
+	*concurrency.Session
+	prefix string
+}
+
+func (s *session) NewMutex(pfx string) component.Mutex {
+	return &mutex{Mutex: concurrency.NewMutex(s.Session, path.Join(s.prefix, pfx))}
+}
+
+func (s *session) NewLocker(pfx string) sync.Locker {
+	return concurrency.NewLocker(s.Session, path.Join(s.prefix, pfx))
+}
+
+type mutex struct {
+	*concurrency.Mutex
+}
+
+// Fence 使用加锁成功时的etcd revision作为fencing token
+func (m *mutex) Fence() int64 {
+	if h := m.Header(); h != nil {
+		return h.Revision
+	}
+	return 0
+}
+
+func (m *mutex) TryLock(ctx context.Context) error {
+	if err := m.Mutex.TryLock(ctx); err != nil {
+		if errors.Is(err, concurrency.ErrLocked) {
+			return component.ErrLocked
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+func TestConcurrency(t *testing.T) {
+	client, prefix := newTestClient(t)
+	defer client.Close()
+	c := NewConcurrency(client, prefix)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s1, err := c.NewSession(ctx, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.NewSession(ctx, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if err := s1.NewMutex("job").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.NewMutex("job").TryLock(ctx); err != component.ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := s1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.NewMutex("job").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/daemtri/begonia/driver/etcd"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func init() {
+	component.Register[component.Configurator](Name, &ConfiguratorBootloader{})
+}
+
+type ConfiguratorBootloader struct {
+	clientOptions
+
+	instance *Configurator
+}
+
+func (c *ConfiguratorBootloader) Boot(logger *logx.Logger) error {
+	client, err := c.newClient()
+	if err != nil {
+		return err
+	}
+	c.instance = NewConfigurator(client, c.namespacePrefix(), logger)
+	return nil
+}
+
+func (c *ConfiguratorBootloader) Retrofit() error {
+	return nil
+}
+
+func (c *ConfiguratorBootloader) Instance() component.Configurator {
+	return c.instance
+}
+
+func (c *ConfiguratorBootloader) Destroy() error {
+	return c.instance.client.Close()
+}
+
+// Configurator 基于etcd的配置中心，配置保存在 {prefix}/configs/{name}
+// 根据name的后缀选择解码方式：.json、.toml，其他按yaml解码
+type Configurator struct {
+	client *etcd.Client
+	prefix string
+	logger *logx.Logger
+}
+
+func NewConfigurator(client *etcd.Client, prefix string, logger *logx.Logger) *Configurator {
+	return &Configurator{
+		client: client,
+		prefix: prefix,
+		logger: logger,
+	}
+}
+
+func (c *Configurator) configKey(name string) string {
+	return path.Join(c.prefix, "configs", name)
+}
+
+func (c *Configurator) ReadConfig(ctx context.Context, name string) (component.ConfigDecoder, error) {
+	decoder, _, err := c.read(ctx, name)
+	return decoder, err
+}
+
+func (c *Configurator) read(ctx context.Context, name string) (component.ConfigDecoder, int64, error) {
+	key := c.configKey(name)
+	resp, err := c.client.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.Revision, fmt.Errorf("config %s not found", key)
+	}
+	return component.NewConfigDecoderByName(name, resp.Kvs[0].Value), resp.Header.Revision, nil
+}
+
+// WatchConfig 第一次调用Next返回当前配置，之后每次配置修改返回新的配置
+func (c *Configurator) WatchConfig(ctx context.Context, name string) component.Stream[component.ConfigDecoder] {
+	ctx, cancel := context.WithCancel(ctx)
+	return &configWatcher{
+		Configurator: c,
+		name:         name,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+type configWatcher struct {
+	*Configurator
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	updates clientv3.WatchChan
+}
+
+func (w *configWatcher) Next() (component.ConfigDecoder, error) {
+	for {
+		if w.updates == nil {
+			decoder, rev, err := w.read(w.ctx, w.name)
+			if err != nil {
+				return nil, err
+			}
+			w.watch(rev)
+			return decoder, nil
+		}
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case resp, ok := <-w.updates:
+			if !ok && w.ctx.Err() != nil {
+				return nil, w.ctx.Err()
+			}
+			err := resp.Err()
+			if !ok {
+				err = errors.New("etcd watch channel closed")
+			}
+			if err != nil {
+				// revision被压缩或者watch被关闭后重新读取配置
+				w.logger.Warn("watch config error, reload", "name", w.name, "error", err)
+				w.updates = nil
+				timer := time.NewTimer(time.Second)
+				select {
+				case <-w.ctx.Done():
+					timer.Stop()
+					return nil, w.ctx.Err()
+				case <-timer.C:
+				}
+				continue
+			}
+			for i := len(resp.Events) - 1; i >= 0; i-- {
+				ev := resp.Events[i]
+				if ev.Type == mvccpb.PUT {
+					return component.NewConfigDecoderByName(w.name, ev.Kv.Value), nil
+				}
+			}
+			w.logger.Warn("config deleted", "name", w.name)
+		}
+	}
+}
+
+func (w *configWatcher) watch(rev int64) {
+	w.updates = w.client.Watch(clientv3.WithRequireLeader(w.ctx), w.configKey(w.name), clientv3.WithRev(rev+1))
+}
+
+func (w *configWatcher) Stop() {
+	w.cancel()
+}
@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestConfigurator(t *testing.T) {
+	client, prefix := newTestClient(t)
+	defer client.Close()
+	c := NewConfigurator(client, prefix, logx.GetLogger("test"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Put(ctx, c.configKey("app.json"), `{"name":"v1"}`); err != nil {
+		t.Fatal(err)
+	}
+	stream := c.WatchConfig(ctx, "app.json")
+	defer stream.Stop()
+
+	var cfg struct {
+		Name string `json:"name"`
+	}
+	for _, want := range []string{"v1", "v2"} {
+		decoder, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := decoder.Decode(&cfg); err != nil || cfg.Name != want {
+			t.Fatalf("expected %s, got %s %v", want, cfg.Name, err)
+		}
+		if _, err := client.Put(ctx, c.configKey("app.json"), `{"name":"v2"}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// watch被关闭后重新读取配置，而不是一直返回错误
+	closed := make(chan clientv3.WatchResponse)
+	close(closed)
+	stream.(*configWatcher).updates = closed
+	decoder, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&cfg); err != nil || cfg.Name != "v2" {
+		t.Fatalf("expected v2 after reload, got %s %v", cfg.Name, err)
+	}
+}
@@ -0,0 +1,441 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daemtri/begonia/driver/etcd"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	component.Register[component.Discovery](Name, &DiscoveryBootloader{})
+}
+
+type DiscoveryBootloader struct {
+	clientOptions
+	ttl time.Duration
+
+	reg *Registry
+}
+
+func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
+	d.clientOptions.AddFlags(fs)
+	fs.DurationVar(&d.ttl, "ttl", 10*time.Second, "服务注册租约时间")
+}
+
+func (d *DiscoveryBootloader) ValidateFlags() error {
+	if d.ttl < time.Second {
+		return fmt.Errorf("etcd discovery ttl must be at least 1s, got %s", d.ttl)
+	}
+	return d.clientOptions.ValidateFlags()
+}
+
+func (d *DiscoveryBootloader) Boot(logger *logx.Logger) error {
+	client, err := d.newClient()
+	if err != nil {
+		return err
+	}
+	d.reg = NewRegistry(client, d.namespacePrefix(), d.ttl, logger)
+	return nil
+}
+
+func (d *DiscoveryBootloader) Retrofit() error {
+	return nil
+}
+
+func (d *DiscoveryBootloader) Instance() component.Discovery {
+	return d.reg
+}
+
+func (d *DiscoveryBootloader) Destroy() error {
+	return d.reg.Close()
+}
+
+// Registry 基于etcd的服务注册发现
+// 服务实例保存在 {prefix}/services/{name}/{id}，值为ServiceEntry的json，绑定租约
+// 服务配置保存在同级的 {prefix}/services/{name}，值为yaml或json格式的键值对，如：LoadBalancingConfig: round_robin
+type Registry struct {
+	client *etcd.Client
+	prefix string
+	ttl    time.Duration
+	logger *logx.Logger
+
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	mux           sync.Mutex
+	registrations map[string]*registration
+}
+
+func NewRegistry(client *etcd.Client, prefix string, ttl time.Duration, logger *logx.Logger) *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+
+		registrations: make(map[string]*registration),
+	}
+}
+
+func (r *Registry) servicePrefix(name string) string {
+	return path.Join(r.prefix, "services", name) + "/"
+}
+
+func (r *Registry) serviceKey(name, id string) string {
+	return path.Join(r.prefix, "services", name, id)
+}
+
+func (r *Registry) configKey(name string) string {
+	return path.Join(r.prefix, "services", name)
+}
+
+// registration 一个已注册服务的续约状态
+type registration struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	leaseID atomic.Int64
+}
+
+// Register 注册服务，并在后台续约，租约丢失后会自动重新注册，直到Deregister或Close
+func (r *Registry) Register(ctx context.Context, service component.ServiceEntry) error {
+	value, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	key := r.serviceKey(service.Name, service.ID)
+	regCtx, cancel := context.WithCancel(r.ctx)
+	reg := &registration{cancel: cancel, done: make(chan struct{})}
+	keepAlive, err := r.register(ctx, regCtx, reg, key, string(value))
+	if err != nil {
+		cancel()
+		return err
+	}
+	r.mux.Lock()
+	prev := r.registrations[key]
+	r.registrations[key] = reg
+	r.mux.Unlock()
+	// 重复注册时停止之前的续约并撤销旧租约，key已经绑定到新租约，否则Deregister无法停止旧的续约
+	if prev != nil {
+		prev.cancel()
+		<-prev.done
+		if _, err := r.client.Revoke(ctx, clientv3.LeaseID(prev.leaseID.Load())); err != nil {
+			r.logger.Warn("revoke previous lease error", "key", key, "error", err)
+		}
+	}
+	r.logger.Info("service registered", "key", key)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(reg.done)
+		backoff := time.Second
+		for {
+			for range keepAlive {
+			}
+			// keepAlive被关闭: Deregister、Close或者租约丢失
+			if regCtx.Err() != nil {
+				return
+			}
+			r.logger.Warn("service lease lost, register again", "key", key)
+			for {
+				select {
+				case <-regCtx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				keepAlive, err = r.register(regCtx, regCtx, reg, key, string(value))
+				if err == nil {
+					backoff = time.Second
+					break
+				}
+				r.logger.Warn("register service error", "key", key, "error", err)
+				backoff = min(backoff*2, r.ttl)
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Registry) register(ctx, regCtx context.Context, reg *registration, key, value string) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	lease, err := r.client.Grant(ctx, int64(r.ttl/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("grant lease error: %w", err)
+	}
+	if _, err := r.client.Put(ctx, key, value, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, fmt.Errorf("put %s error: %w", key, err)
+	}
+	reg.leaseID.Store(int64(lease.ID))
+	return r.client.KeepAlive(regCtx, lease.ID)
+}
+
+// Deregister 停止续约并撤销租约，服务实例会立即从etcd中删除
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	key := r.serviceKey(service.Name, service.ID)
+	r.mux.Lock()
+	reg, ok := r.registrations[key]
+	delete(r.registrations, key)
+	r.mux.Unlock()
+	if !ok {
+		return fmt.Errorf("service %s not registered", key)
+	}
+	reg.cancel()
+	<-reg.done
+	if _, err := r.client.Revoke(ctx, clientv3.LeaseID(reg.leaseID.Load())); err != nil {
+		r.logger.Warn("revoke lease error, delete key", "key", key, "error", err)
+		if _, err := r.client.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	r.logger.Info("service deregistered", "key", key)
+	return nil
+}
+
+func (r *Registry) Lookup(ctx context.Context, name, id string) (*component.ServiceEntry, error) {
+	resp, err := r.client.Get(ctx, r.serviceKey(name, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("service %s/%s not found", name, id)
+	}
+	var se component.ServiceEntry
+	if err := json.Unmarshal(resp.Kvs[0].Value, &se); err != nil {
+		return nil, fmt.Errorf("invalid service entry %s: %w", resp.Kvs[0].Key, err)
+	}
+	return &se, nil
+}
+
+func (r *Registry) Browse(ctx context.Context, name string) (*component.Service, error) {
+	s, _, err := r.browse(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.service(), nil
+}
+
+// browse 在同一个revision下读取服务实例和服务配置
+func (r *Registry) browse(ctx context.Context, name string) (*serviceState, int64, error) {
+	resp, err := r.client.Txn(ctx).Then(
+		clientv3.OpGet(r.servicePrefix(name), clientv3.WithPrefix()),
+		clientv3.OpGet(r.configKey(name)),
+	).Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+	state := newServiceState()
+	for _, kv := range resp.Responses[0].GetResponseRange().Kvs {
+		state.putEntry(r.logger, kv)
+	}
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) > 0 {
+		state.putConfig(r.logger, kvs[0].Value)
+	}
+	return state, resp.Header.Revision, nil
+}
+
+// Watch 监听服务变化，调用方的ctx取消、Stop或者Close时停止
+func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	wctx, cancel := context.WithCancel(r.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	w := &serviceWatcher{
+		ctx: wctx,
+		cancel: func() {
+			stop()
+			cancel()
+		},
+		updates: make(chan *component.Service, 1),
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.watch(wctx, name, w)
+	}()
+	return w
+}
+
+func (r *Registry) watch(ctx context.Context, name string, w *serviceWatcher) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		state, rev, err := r.browse(ctx, name)
+		if err != nil {
+			r.logger.Warn("browse service error", "name", name, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = time.Second
+		w.push(state.service())
+
+		// 每次重新同步时取消上一次的两个watch，避免一个watch出错后另一个泄漏
+		wctx, wcancel := context.WithCancel(ctx)
+		lctx := clientv3.WithRequireLeader(wctx)
+		services := r.client.Watch(lctx, r.servicePrefix(name), clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		configs := r.client.Watch(lctx, r.configKey(name), clientv3.WithRev(rev+1))
+		err = r.applyEvents(ctx, name, state, services, configs, w)
+		wcancel()
+		if err != nil {
+			r.logger.Warn("watch service error, resync", "name", name, "error", err)
+		}
+	}
+}
+
+func (r *Registry) applyEvents(ctx context.Context, name string, state *serviceState, services, configs clientv3.WatchChan, w *serviceWatcher) error {
+	for {
+		var resp clientv3.WatchResponse
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return nil
+		case resp, ok = <-services:
+		case resp, ok = <-configs:
+		}
+		if !ok {
+			return errors.New("watch channel closed")
+		}
+		if err := resp.Err(); err != nil {
+			if errors.Is(err, rpctypes.ErrCompacted) {
+				return fmt.Errorf("revision compacted: %w", err)
+			}
+			return err
+		}
+		for _, ev := range resp.Events {
+			isConfig := string(ev.Kv.Key) == r.configKey(name)
+			switch {
+			case isConfig && ev.Type == mvccpb.DELETE:
+				state.configs = nil
+			case isConfig:
+				state.putConfig(r.logger, ev.Kv.Value)
+			case ev.Type == mvccpb.DELETE:
+				delete(state.entries, string(ev.Kv.Key))
+			default:
+				state.putEntry(r.logger, ev.Kv)
+			}
+		}
+		w.push(state.service())
+	}
+}
+
+// Close 停止续约和所有watch，并关闭etcd连接
+func (r *Registry) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return r.client.Close()
+}
+
+type serviceState struct {
+	entries map[string]component.ServiceEntry
+	configs []component.ConfigItem
+}
+
+func newServiceState() *serviceState {
+	return &serviceState{entries: make(map[string]component.ServiceEntry)}
+}
+
+func (s *serviceState) putEntry(logger *logx.Logger, kv *mvccpb.KeyValue) {
+	var se component.ServiceEntry
+	if err := json.Unmarshal(kv.Value, &se); err != nil {
+		logger.Warn("invalid service entry", "key", string(kv.Key), "error", err)
+		return
+	}
+	s.entries[string(kv.Key)] = se
+}
+
+func (s *serviceState) putConfig(logger *logx.Logger, raw []byte) {
+	configs, err := parseServiceConfigs(raw)
+	if err != nil {
+		logger.Warn("invalid service config", "error", err)
+		return
+	}
+	s.configs = configs
+}
+
+func (s *serviceState) service() *component.Service {
+	keys := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	svc := &component.Service{
+		Entries: make([]component.ServiceEntry, 0, len(keys)),
+		Configs: slices.Clone(s.configs),
+	}
+	for _, k := range keys {
+		svc.Entries = append(svc.Entries, s.entries[k])
+	}
+	return svc
+}
+
+// parseServiceConfigs 解析yaml或json格式的服务配置，如：{"LoadBalancingConfig":"round_robin"}
+func parseServiceConfigs(raw []byte) ([]component.ConfigItem, error) {
+	m := map[string]string{}
+	if err := yaml.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	items := make([]component.ConfigItem, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, component.ConfigItem{Key: k, Value: m[k]})
+	}
+	return items, nil
+}
+
+type serviceWatcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	updates chan *component.Service
+}
+
+// push 只保留最新的服务状态，未被消费的旧状态会被丢弃
+func (w *serviceWatcher) push(s *component.Service) {
+	for {
+		select {
+		case w.updates <- s:
+			return
+		case <-w.ctx.Done():
+			return
+		default:
+		}
+		select {
+		case <-w.updates:
+		default:
+		}
+	}
+}
+
+func (w *serviceWatcher) Next() (*component.Service, error) {
+	select {
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	case s := <-w.updates:
+		return s, nil
+	}
+}
+
+func (w *serviceWatcher) Stop() {
+	w.cancel()
+}
@@ -0,0 +1,186 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/driver/etcd"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"github.com/segmentio/ksuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// testEndpoints 测试使用的etcd地址，设置了ETCD_ENDPOINTS时使用外部etcd，否则启动内嵌的etcd
+var testEndpoints []string
+
+func TestMain(m *testing.M) {
+	if endpoints := os.Getenv("ETCD_ENDPOINTS"); endpoints != "" {
+		testEndpoints = strings.Split(endpoints, ",")
+		os.Exit(m.Run())
+	}
+	dir, err := os.MkdirTemp("", "begonia-etcd")
+	if err != nil {
+		panic(err)
+	}
+	e, err := startEmbedEtcd(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(err)
+	}
+	testEndpoints = []string{e.Clients[0].Addr().String()}
+	code := m.Run()
+	e.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func startEmbedEtcd(dir string) (*embed.Etcd, error) {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	for _, u := range []*[]url.URL{&cfg.ListenClientUrls, &cfg.ListenPeerUrls} {
+		addr, err := freeAddr()
+		if err != nil {
+			return nil, err
+		}
+		*u = []url.URL{{Scheme: "http", Host: addr}}
+	}
+	cfg.AdvertiseClientUrls = cfg.ListenClientUrls
+	cfg.AdvertisePeerUrls = cfg.ListenPeerUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+		return e, nil
+	case <-time.After(10 * time.Second):
+		e.Close()
+		return nil, errors.New("embed etcd start timeout")
+	}
+}
+
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func newTestClient(t *testing.T) (*etcd.Client, string) {
+	opts := &etcd.Options{Endpoints: testEndpoints, DialTimeout: 3 * time.Second}
+	client, err := opts.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, "/begonia-test/" + ksuid.New().String()
+}
+
+func TestParseServiceConfigs(t *testing.T) {
+	items, err := parseServiceConfigs([]byte("LoadBalancingConfig: round_robin\nGrayReleaseConfig: '>=1.0.0'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Key != "GrayReleaseConfig" || items[1].Value != "round_robin" {
+		t.Errorf("unexpected configs %v", items)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	client, prefix := newTestClient(t)
+	reg := NewRegistry(client, prefix, 2*time.Second, logx.GetLogger("test"))
+	defer reg.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream := reg.Watch(ctx, "app")
+	defer stream.Stop()
+	if s, err := stream.Next(); err != nil || len(s.Entries) != 0 {
+		t.Fatalf("unexpected initial service %v %v", s, err)
+	}
+
+	entry := component.ServiceEntry{ID: "1", Name: "app", Endpoints: []string{"grpc://127.0.0.1:80"}}
+	if err := reg.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, reg.configKey("app"), `{"LoadBalancingConfig":"round_robin"}`); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		s, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Entries) == 1 && len(s.Configs) == 1 {
+			if !s.Entries[0].Equal(&entry) || s.Configs[0].Value != "round_robin" {
+				t.Errorf("unexpected service %+v", s)
+			}
+			break
+		}
+	}
+
+	se, err := reg.Lookup(ctx, "app", "1")
+	if err != nil || !se.Equal(&entry) {
+		t.Errorf("lookup got %v %v", se, err)
+	}
+
+	if err := reg.Deregister(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Lookup(ctx, "app", "1"); err == nil {
+		t.Error("service should be deleted after deregister")
+	}
+}
+
+func TestRegistryLifetime(t *testing.T) {
+	client, prefix := newTestClient(t)
+	reg := NewRegistry(client, prefix, 2*time.Second, logx.GetLogger("test"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 重复注册时撤销之前的租约
+	entry := component.ServiceEntry{ID: "1", Name: "app", Endpoints: []string{"grpc://127.0.0.1:80"}}
+	leaseID := func() clientv3.LeaseID {
+		reg.mux.Lock()
+		defer reg.mux.Unlock()
+		return clientv3.LeaseID(reg.registrations[reg.serviceKey("app", "1")].leaseID.Load())
+	}
+	if err := reg.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	first := leaseID()
+	if err := reg.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if leaseID() == first {
+		t.Fatal("expected a new lease")
+	}
+	if ttl, err := client.TimeToLive(ctx, first); err != nil || ttl.TTL > 0 {
+		t.Errorf("previous lease not revoked: %v %v", ttl, err)
+	}
+
+	// Close后停止watch
+	stream := reg.Watch(context.Background(), "app")
+	if _, err := stream.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Next(); err != nil {
+			break
+		}
+	}
+}
@@ -4,14 +4,23 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"log/slog"
 
 	"context"
 
-	"github.com/daemtri/begonia/di/box/validate"
+	"github.com/daemtri/begonia/runtime"
 	"github.com/daemtri/begonia/runtime/component"
+	"github.com/fsnotify/fsnotify"
 	"sigs.k8s.io/yaml"
 )
 
@@ -21,90 +30,372 @@ func init() {
 
 type DiscoveryBootloader struct {
 	ServiceFile string
+	Dir         string
+	TTL         time.Duration
 
-	reg Registry
+	reg *Registry
 }
 
 func (d *DiscoveryBootloader) Destroy() error {
-	//TODO implement me
-	panic("implement me")
+	return d.reg.Close()
 }
 
 func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
-	fs.StringVar(&d.ServiceFile, "appsfile", "./configs/apps.yaml", "服务发现前缀")
+	fs.StringVar(&d.ServiceFile, "appsfile", "./configs/apps.yaml", "静态服务列表文件,不存在时忽略")
+	fs.StringVar(&d.Dir, "dir", filepath.Join(os.TempDir(), "begonia", "registry"), "服务注册目录,同一台机器上的进程共享")
+	fs.DurationVar(&d.TTL, "ttl", 10*time.Second, "注册文件的心跳超时时间,每ttl/3更新一次文件修改时间")
 }
 
 func (d *DiscoveryBootloader) ValidateFlags() error {
-	return validate.Struct(d)
+	if d.TTL < time.Second {
+		return fmt.Errorf("file discovery ttl must be at least 1s, got %s", d.TTL)
+	}
+	return nil
 }
 
 func (d *DiscoveryBootloader) Boot(logger *slog.Logger) error {
-	d.reg.logger = logger
-	d.reg.ServiceFile = d.ServiceFile
-	return d.reg.Boot()
+	dir, err := filepath.Abs(d.Dir)
+	if err != nil {
+		return err
+	}
+	services, err := loadServiceFile(d.ServiceFile)
+	if err != nil {
+		return err
+	}
+	d.reg = NewRegistry(filepath.Join(dir, runtime.GetNamespace()), d.TTL, services, logger)
+	return nil
 }
 
 func (d *DiscoveryBootloader) Retrofit() error {
-	//TODO implement me
-	panic("implement me")
+	return nil
 }
 
 func (d *DiscoveryBootloader) Instance() component.Discovery {
-	return &d.reg
-}
-
-type Registry struct {
-	ServiceFile string
-	logger      *slog.Logger
-	services    []component.ServiceEntry
+	return d.reg
 }
 
-func (r *Registry) Boot() error {
-	serviceFileRawYaml, err := os.ReadFile(r.ServiceFile)
+// loadServiceFile 读取静态服务列表，文件不存在时返回空列表
+func loadServiceFile(serviceFile string) ([]component.ServiceEntry, error) {
+	serviceFileRawYaml, err := os.ReadFile(serviceFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	serviceFileJSONRaw, err := yaml.YAMLToJSON(serviceFileRawYaml)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var services []component.ServiceEntry
 	if err := json.Unmarshal(serviceFileJSONRaw, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// Registry 基于本地目录的服务注册发现，用于在一台机器上运行多个服务进程
+// 每个实例保存为 {dir}/{name}/{id}.json，注册后定期更新文件修改时间作为心跳
+// 修改时间超过ttl的文件视为已退出的进程，读取时忽略并清理
+// 静态服务列表中的服务始终存在
+type Registry struct {
+	dir      string
+	ttl      time.Duration
+	services []component.ServiceEntry
+	logger   *slog.Logger
+
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	mux           sync.Mutex
+	registrations map[string]context.CancelFunc
+}
+
+func NewRegistry(dir string, ttl time.Duration, services []component.ServiceEntry, logger *slog.Logger) *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		dir:           dir,
+		ttl:           ttl,
+		services:      services,
+		logger:        logger,
+		ctx:           ctx,
+		cancel:        cancel,
+		registrations: make(map[string]context.CancelFunc),
+	}
+}
+
+func (r *Registry) serviceDir(name string) string {
+	return filepath.Join(r.dir, name)
+}
+
+func (r *Registry) entryFile(name, id string) string {
+	return filepath.Join(r.serviceDir(name), id+".json")
+}
+
+// writeEntry 先写临时文件再重命名，避免读取到写了一半的文件
+func (r *Registry) writeEntry(service component.ServiceEntry, data []byte) error {
+	if err := os.MkdirAll(r.serviceDir(service.Name), 0o755); err != nil {
 		return err
 	}
-	r.services = services
-	return nil
+	file := r.entryFile(service.Name, service.ID)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
 }
 
 func (r *Registry) Register(ctx context.Context, service component.ServiceEntry) error {
-	r.logger.Info("register", "service", service)
+	r.logger.Info("register", "service", service, "dir", r.serviceDir(service.Name))
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	if err := r.writeEntry(service, data); err != nil {
+		return fmt.Errorf("write registration file error: %w", err)
+	}
+
+	file := r.entryFile(service.Name, service.ID)
+	hctx, cancel := context.WithCancel(r.ctx)
+	r.mux.Lock()
+	if prev, ok := r.registrations[file]; ok {
+		prev()
+	}
+	r.registrations[file] = cancel
+	r.mux.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.heartbeat(hctx, service, data)
+	}()
 	return nil
 }
 
+// heartbeat 每ttl/3更新一次文件修改时间，文件被删除时重新写入
+func (r *Registry) heartbeat(ctx context.Context, service component.ServiceEntry, data []byte) {
+	file := r.entryFile(service.Name, service.ID)
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			err := os.Chtimes(file, now, now)
+			if errors.Is(err, fs.ErrNotExist) {
+				err = r.writeEntry(service, data)
+			}
+			if err != nil {
+				r.logger.Warn("refresh registration file error", "file", file, "error", err)
+			}
+		}
+	}
+}
+
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	r.logger.Info("deregister", "service", service)
+	file := r.entryFile(service.Name, service.ID)
+	r.mux.Lock()
+	if cancel, ok := r.registrations[file]; ok {
+		cancel()
+		delete(r.registrations, file)
+	}
+	r.mux.Unlock()
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Close 停止心跳并删除本进程注册的文件
+func (r *Registry) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	var errs []error
+	for file := range r.registrations {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	r.registrations = map[string]context.CancelFunc{}
+	return errors.Join(errs...)
+}
+
 func (r *Registry) Lookup(ctx context.Context, name, id string) (se *component.ServiceEntry, err error) {
-	for i := range r.services {
-		if id == r.services[i].ID && name == r.services[i].Name {
-			return &r.services[i], nil
+	s, _, err := r.browse(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Entries {
+		if id == s.Entries[i].ID {
+			return &s.Entries[i], nil
 		}
 	}
-	err = errors.New("service not found")
-	return
+	return nil, errors.New("service not found")
 }
 
 func (r *Registry) Browse(ctx context.Context, name string) (*component.Service, error) {
+	s, _, err := r.browse(name)
+	return s, err
+}
+
+// browse 读取静态服务和未过期的注册文件，同时返回最早的过期时间，没有注册文件时为零值
+func (r *Registry) browse(name string) (*component.Service, time.Time, error) {
 	ses := make([]component.ServiceEntry, 0, 1)
 	for i := range r.services {
 		if name == r.services[i].Name {
 			ses = append(ses, r.services[i])
 		}
 	}
-	return &component.Service{
-		Entries: ses,
-	}, nil
+	files, err := os.ReadDir(r.serviceDir(name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, err
+	}
+	var nextExpiry time.Time
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		file := filepath.Join(r.serviceDir(name), f.Name())
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		expiry := info.ModTime().Add(r.ttl)
+		if time.Now().After(expiry) {
+			r.logger.Info("remove stale registration file", "file", file)
+			_ = os.Remove(file)
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		se := component.ServiceEntry{}
+		if err := json.Unmarshal(data, &se); err != nil {
+			r.logger.Warn("invalid registration file", "file", file, "error", err)
+			continue
+		}
+		ses = append(ses, se)
+		if nextExpiry.IsZero() || expiry.Before(nextExpiry) {
+			nextExpiry = expiry
+		}
+	}
+	slices.SortFunc(ses, func(a, b component.ServiceEntry) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return &component.Service{Entries: ses}, nextExpiry, nil
 }
 
 func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
-	ci := component.NewChanStream[*component.Service](ctx)
-	ci.Send(r.Browse(ctx, name))
+	ctx, cancel := context.WithCancel(ctx)
+	return &serviceWatcher{
+		Registry: r,
+		name:     name,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+type serviceWatcher struct {
+	*Registry
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mux 保护watcher和timer的创建，Stop可能和Next并发调用
+	mux     sync.Mutex
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+	last    *component.Service
+}
+
+// init 监听服务目录，Stop之后不再创建watcher
+func (w *serviceWatcher) init() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.watcher != nil {
+		return nil
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	dir := w.serviceDir(w.name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("watch dir %s error: %w", dir, err)
+	}
+	w.watcher = watcher
+	w.timer = time.NewTimer(w.ttl)
 	return nil
 }
+
+// Next 第一次调用返回当前服务信息，之后在注册文件增删改或有实例心跳超时时返回
+func (w *serviceWatcher) Next() (*component.Service, error) {
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	for {
+		if w.last != nil {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					return nil, errors.New("file watcher closed")
+				}
+				// 心跳只修改文件时间，由timer检查过期
+				if event.Op == fsnotify.Chmod || strings.HasSuffix(event.Name, ".tmp") {
+					continue
+				}
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return nil, errors.New("file watcher closed")
+				}
+				w.logger.Warn("file watcher error", "service", w.name, "error", err)
+			case <-w.timer.C:
+			}
+		}
+		s, nextExpiry, err := w.browse(w.name)
+		if err != nil {
+			return nil, err
+		}
+		wait := w.ttl
+		if !nextExpiry.IsZero() {
+			wait = max(time.Until(nextExpiry)+10*time.Millisecond, 10*time.Millisecond)
+		}
+		if !w.timer.Stop() {
+			select {
+			case <-w.timer.C:
+			default:
+			}
+		}
+		w.timer.Reset(wait)
+		if w.last != nil && reflect.DeepEqual(w.last, s) {
+			continue
+		}
+		w.last = s
+		return s, nil
+	}
+}
+
+func (w *serviceWatcher) Stop() {
+	w.cancel()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.watcher != nil {
+		_ = w.watcher.Close()
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,121 @@
+package files
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	static := []component.ServiceEntry{{ID: "static", Name: "app"}}
+	// 两个Registry模拟同一台机器上的两个进程
+	r1 := NewRegistry(dir, time.Second, static, logx.GetLogger("test"))
+	r2 := NewRegistry(dir, time.Second, nil, logx.GetLogger("test"))
+	defer r2.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := r1.Watch(ctx, "app")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 || s.Entries[0].ID != "static" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+
+	entry := component.ServiceEntry{ID: "uuid-0", Name: "app", Endpoints: []string{"grpc://127.0.0.1:8090"}}
+	if err := r2.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 2 || s.Entries[1].ID != "uuid-0" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	// 心跳保持注册文件不过期
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := r1.Lookup(ctx, "app", "uuid-0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+}
+
+func TestRegistryStale(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry(dir, time.Second, nil, logx.GetLogger("test"))
+	entry := component.ServiceEntry{ID: "crashed", Name: "app"}
+	if err := r.writeEntry(entry, []byte(`{"id":"crashed","name":"app"}`)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := r.Watch(ctx, "app")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	// 没有心跳的注册文件在ttl后被清理
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	if _, err := os.Stat(r.entryFile("app", "crashed")); !os.IsNotExist(err) {
+		t.Fatalf("stale file not removed: %v", err)
+	}
+}
+
+func TestRegistryStopWatch(t *testing.T) {
+	r := NewRegistry(t.TempDir(), time.Second, nil, logx.GetLogger("test"))
+	defer r.Close()
+
+	// Stop和Next并发调用
+	for i := 0; i < 10; i++ {
+		stream := r.Watch(context.Background(), "app")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, err := stream.Next(); err != nil {
+					return
+				}
+			}
+		}()
+		stream.Stop()
+		<-done
+	}
+	// Stop之后不再创建watcher
+	stream := r.Watch(context.Background(), "app")
+	stream.Stop()
+	if _, err := stream.Next(); err == nil {
+		t.Fatal("expected error after stop")
+	}
+	if stream.(*serviceWatcher).watcher != nil {
+		t.Fatal("watcher created after stop")
+	}
+}
@@ -0,0 +1,214 @@
+package k8s
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime"
+	"github.com/daemtri/begonia/runtime/component"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	component.Register[component.Configurator](Name, &ConfiguratorBootloader{})
+}
+
+type ConfiguratorBootloader struct {
+	namespace  string
+	configMap  string
+	kubeconfig string
+
+	instance *Configurator
+}
+
+func (c *ConfiguratorBootloader) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.namespace, "namespace", "", "ConfigMap所在的namespace,默认为pod所在的namespace")
+	fs.StringVar(&c.configMap, "configmap", "", "默认的ConfigMap名称,默认为服务名")
+	fs.StringVar(&c.kubeconfig, "kubeconfig", "", "kubeconfig文件路径,为空时使用集群内配置")
+}
+
+func (c *ConfiguratorBootloader) ValidateFlags() error {
+	return nil
+}
+
+func (c *ConfiguratorBootloader) Boot(logger *logx.Logger) error {
+	clientset, err := newClientset(c.kubeconfig)
+	if err != nil {
+		return err
+	}
+	if c.namespace == "" {
+		c.namespace = podNamespace()
+	}
+	if c.configMap == "" {
+		c.configMap = runtime.GetServiceName()
+	}
+	c.instance = NewConfigurator(clientset, c.namespace, c.configMap, logger)
+	return nil
+}
+
+func (c *ConfiguratorBootloader) Retrofit() error {
+	return nil
+}
+
+func (c *ConfiguratorBootloader) Instance() component.Configurator {
+	return c.instance
+}
+
+func (c *ConfiguratorBootloader) Destroy() error {
+	return nil
+}
+
+// Configurator 基于ConfigMap的配置中心
+// name形如 {key} 时读取默认ConfigMap中的key，形如 {configmap}/{key} 时读取指定ConfigMap中的key
+// key不存在时会依次尝试 .yaml、.yml、.json、.toml 后缀，并根据后缀选择解码方式，没有后缀时按yaml解码
+type Configurator struct {
+	clientset kubernetes.Interface
+	namespace string
+	configMap string
+	logger    *logx.Logger
+}
+
+func NewConfigurator(clientset kubernetes.Interface, namespace, configMap string, logger *logx.Logger) *Configurator {
+	return &Configurator{
+		clientset: clientset,
+		namespace: namespace,
+		configMap: configMap,
+		logger:    logger,
+	}
+}
+
+var configSuffixes = []string{"", ".yaml", ".yml", ".json", ".toml"}
+
+func (c *Configurator) parseName(name string) (configMap, key string) {
+	if cm, key, ok := strings.Cut(name, "/"); ok {
+		return cm, key
+	}
+	return c.configMap, name
+}
+
+// lookup 在ConfigMap中查找配置，返回实际的key和内容
+func lookup(cm *corev1.ConfigMap, key string) (string, []byte, bool) {
+	for _, suffix := range configSuffixes {
+		if v, ok := cm.Data[key+suffix]; ok {
+			return key + suffix, []byte(v), true
+		}
+		if v, ok := cm.BinaryData[key+suffix]; ok {
+			return key + suffix, v, true
+		}
+	}
+	return "", nil, false
+}
+
+func (c *Configurator) ReadConfig(ctx context.Context, name string) (component.ConfigDecoder, error) {
+	cmName, key := c.parseName(name)
+	cm, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, cmName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	actualKey, raw, ok := lookup(cm, key)
+	if !ok {
+		return nil, fmt.Errorf("config %s not found in configmap %s/%s", key, c.namespace, cmName)
+	}
+	return component.NewConfigDecoderByName(actualKey, raw), nil
+}
+
+// WatchConfig 第一次调用Next返回当前配置，之后每次配置内容变化返回新的配置
+func (c *Configurator) WatchConfig(ctx context.Context, name string) component.Stream[component.ConfigDecoder] {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &configWatcher{
+		Configurator: c,
+		name:         name,
+		ctx:          ctx,
+		cancel:       cancel,
+		updates:      make(chan *corev1.ConfigMap, 1),
+	}
+	return w
+}
+
+type configWatcher struct {
+	*Configurator
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	updates chan *corev1.ConfigMap
+
+	started bool
+	last    string
+}
+
+func (w *configWatcher) start() {
+	cmName, _ := w.parseName(w.name)
+	factory := informers.NewSharedInformerFactoryWithOptions(w.clientset, 0,
+		informers.WithNamespace(w.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", cmName).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	push := func(obj any) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		select {
+		case <-w.updates:
+		default:
+		}
+		w.updates <- cm
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    push,
+		UpdateFunc: func(_, obj any) { push(obj) },
+		DeleteFunc: func(obj any) {
+			w.logger.Warn("configmap deleted", "namespace", w.namespace, "name", cmName)
+		},
+	})
+	if err != nil {
+		w.logger.Warn("add configmap event handler error", "error", err)
+	}
+	factory.Start(w.ctx.Done())
+}
+
+func (w *configWatcher) Next() (component.ConfigDecoder, error) {
+	if !w.started {
+		decoder, err := w.ReadConfig(w.ctx, w.name)
+		if err != nil {
+			return nil, err
+		}
+		w.started = true
+		w.last = string(decoder.Raw())
+		w.start()
+		return decoder, nil
+	}
+	_, key := w.parseName(w.name)
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case cm := <-w.updates:
+			actualKey, raw, ok := lookup(cm, key)
+			if !ok {
+				w.logger.Warn("config key not found in configmap", "name", w.name)
+				continue
+			}
+			// 其他key变化或者resync时内容相同，忽略
+			if string(raw) == w.last {
+				continue
+			}
+			w.last = string(raw)
+			return component.NewConfigDecoderByName(actualKey, raw), nil
+		}
+	}
+}
+
+func (w *configWatcher) Stop() {
+	w.cancel()
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigurator(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "test"},
+		Data: map[string]string{
+			"app.yaml":   "name: v1\n",
+			"other.json": `{"name":"other"}`,
+		},
+	}
+	clientset := fake.NewSimpleClientset(cm)
+	c := NewConfigurator(clientset, "test", "app", logx.GetLogger("test"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cfg struct {
+		Name string `json:"name"`
+	}
+	decoder, err := c.ReadConfig(ctx, "app/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&cfg); err != nil || cfg.Name != "other" {
+		t.Fatalf("unexpected config %s %v", cfg.Name, err)
+	}
+
+	stream := c.WatchConfig(ctx, "app")
+	defer stream.Stop()
+	decoder, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&cfg); err != nil || cfg.Name != "v1" {
+		t.Fatalf("unexpected config %s %v", cfg.Name, err)
+	}
+
+	cm = cm.DeepCopy()
+	cm.Data["app.yaml"] = "name: v2\n"
+	if _, err := clientset.CoreV1().ConfigMaps("test").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&cfg); err != nil || cfg.Name != "v2" {
+		t.Fatalf("unexpected config %s %v", cfg.Name, err)
+	}
+}
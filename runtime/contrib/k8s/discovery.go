@@ -1,25 +1,42 @@
 package k8s
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
-	"log/slog"
-
-	"context"
-
-	"github.com/daemtri/begonia/di/box/validate"
+	"github.com/daemtri/begonia/logx"
 	"github.com/daemtri/begonia/runtime/component"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	listersdiscoveryv1 "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
 	Name = "k8s"
+
+	// 注册时写入pod的注解
+	annotationID       = "begonia.io/id"
+	annotationAlias    = "begonia.io/alias"
+	annotationVersion  = "begonia.io/version"
+	annotationMetadata = "begonia.io/metadata"
+	// Service上以该前缀开头的注解会作为服务配置，如：begonia.io/config.LoadBalancingConfig: round_robin
+	annotationConfigPrefix = "begonia.io/config."
+	labelVersion           = "app.kubernetes.io/version"
 )
 
 func init() {
@@ -27,68 +44,160 @@ func init() {
 }
 
 type DiscoveryBootloader struct {
-	Namespace string
+	Namespace  string
+	Kubeconfig string
+	PodName    string
 
-	reg Registry
-}
-
-func (d *DiscoveryBootloader) Destroy() error {
-	//TODO implement me
-	panic("implement me")
+	reg *Registry
 }
 
 func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
-	fs.StringVar(&d.Namespace, "namespace", "default", "k8s服务发现的namespace")
+	fs.StringVar(&d.Namespace, "namespace", "", "k8s服务发现的namespace,默认为pod所在的namespace")
+	fs.StringVar(&d.Kubeconfig, "kubeconfig", "", "kubeconfig文件路径,为空时使用集群内配置")
+	fs.StringVar(&d.PodName, "pod_name", os.Getenv("POD_NAME"), "当前pod名称,注册时会将服务信息写入pod注解")
 }
 
 func (d *DiscoveryBootloader) ValidateFlags() error {
-	return validate.Struct(d)
+	return nil
 }
 
-func (d *DiscoveryBootloader) Boot(logger *slog.Logger) error {
-	config, err := rest.InClusterConfig()
+func (d *DiscoveryBootloader) Boot(logger *logx.Logger) error {
+	clientset, err := newClientset(d.Kubeconfig)
 	if err != nil {
-		panic(err.Error())
+		return fmt.Errorf("create k8s clientset error: %w", err)
 	}
-	// Create a Kubernetes client using the configuration.
-	// see: https://kubernetes.io/zh-cn/docs/reference/kubernetes-api/service-resources/endpoints-v1/
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err.Error())
+	if d.Namespace == "" {
+		d.Namespace = podNamespace()
 	}
-
-	d.reg.logger = logger
-	d.reg.clientset = clientset
-	d.reg.namespace = d.Namespace
-	return d.reg.Boot()
+	d.reg = NewRegistry(clientset, d.Namespace, d.PodName, logger)
+	return nil
 }
 
 func (d *DiscoveryBootloader) Retrofit() error {
-	//TODO implement me
-	panic("implement me")
+	return nil
 }
 
 func (d *DiscoveryBootloader) Instance() component.Discovery {
-	return &d.reg
+	return d.reg
+}
+
+func (d *DiscoveryBootloader) Destroy() error {
+	d.reg.Close()
+	return nil
 }
 
+// Registry 基于EndpointSlice的服务发现
+// 服务实例来自名为{name}的Service对应的EndpointSlice中就绪的地址，端口名作为endpoint的schema，如：grpc://10.0.0.1:8090
+// 实例的ID、版本和元数据来自pod的注解和标签，服务配置来自Service的注解
+// 注册时不会修改EndpointSlice，pod是否可以被发现由readiness决定，Register只会将服务信息写入当前pod的注解
 type Registry struct {
+	clientset kubernetes.Interface
 	namespace string
-	clientset *kubernetes.Clientset
-	logger    *slog.Logger
-	services  []component.ServiceEntry
+	podName   string
+	logger    *logx.Logger
+
+	startOnce     sync.Once
+	stop          chan struct{}
+	factory       informers.SharedInformerFactory
+	sliceInformer cache.SharedIndexInformer
+	podInformer   cache.SharedIndexInformer
+	svcInformer   cache.SharedIndexInformer
+	sliceLister   listersdiscoveryv1.EndpointSliceLister
+	podLister     listerscorev1.PodLister
+	serviceLister listerscorev1.ServiceLister
+	watchersMux   sync.Mutex
+	watchers      map[*serviceWatcher]struct{}
 }
 
-func (r *Registry) Boot() error {
+func NewRegistry(clientset kubernetes.Interface, namespace, podName string, logger *logx.Logger) *Registry {
+	r := &Registry{
+		clientset: clientset,
+		namespace: namespace,
+		podName:   podName,
+		logger:    logger,
+		stop:      make(chan struct{}),
+		watchers:  make(map[*serviceWatcher]struct{}),
+	}
+	r.factory = informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+	r.sliceInformer = r.factory.Discovery().V1().EndpointSlices().Informer()
+	r.podInformer = r.factory.Core().V1().Pods().Informer()
+	r.svcInformer = r.factory.Core().V1().Services().Informer()
+	r.sliceLister = r.factory.Discovery().V1().EndpointSlices().Lister()
+	r.podLister = r.factory.Core().V1().Pods().Lister()
+	r.serviceLister = r.factory.Core().V1().Services().Lister()
+	return r
+}
+
+// start 第一次使用时启动informer并等待缓存同步
+func (r *Registry) start(ctx context.Context) error {
+	r.startOnce.Do(func() {
+		notify := func(any) { r.notifyWatchers() }
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    notify,
+			UpdateFunc: func(_, obj any) { notify(obj) },
+			DeleteFunc: notify,
+		}
+		for _, informer := range []cache.SharedIndexInformer{r.sliceInformer, r.podInformer, r.svcInformer} {
+			if _, err := informer.AddEventHandler(handler); err != nil {
+				r.logger.Warn("add event handler error", "error", err)
+			}
+		}
+		r.factory.Start(r.stop)
+	})
+	if !cache.WaitForCacheSync(ctx.Done(), r.sliceInformer.HasSynced, r.podInformer.HasSynced, r.svcInformer.HasSynced) {
+		return fmt.Errorf("wait for k8s informer cache sync: %w", context.Cause(ctx))
+	}
 	return nil
 }
 
+// Register 将服务信息写入当前pod的注解，未设置pod名称时忽略
 func (r *Registry) Register(ctx context.Context, service component.ServiceEntry) error {
-	r.logger.Info("register", "service", service)
+	if r.podName == "" {
+		r.logger.Info("pod name not set, skip register", "service", service)
+		return nil
+	}
+	metadata, err := json.Marshal(service.Metadata)
+	if err != nil {
+		return err
+	}
+	if err := r.patchPodAnnotations(ctx, map[string]any{
+		annotationID:       service.ID,
+		annotationAlias:    service.Alias,
+		annotationVersion:  service.Version,
+		annotationMetadata: string(metadata),
+	}); err != nil {
+		return fmt.Errorf("register pod %s/%s error: %w", r.namespace, r.podName, err)
+	}
+	r.logger.Info("register", "pod", r.podName, "service", service)
 	return nil
 }
 
-func (r *Registry) Lookup(ctx context.Context, name, id string) (se *component.ServiceEntry, err error) {
+// Deregister 删除pod上的服务注解，实例是否从EndpointSlice中移除由readiness决定
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	if r.podName == "" {
+		return nil
+	}
+	r.logger.Info("deregister", "pod", r.podName, "service", service)
+	return r.patchPodAnnotations(ctx, map[string]any{
+		annotationID:       nil,
+		annotationAlias:    nil,
+		annotationVersion:  nil,
+		annotationMetadata: nil,
+	})
+}
+
+func (r *Registry) patchPodAnnotations(ctx context.Context, annotations map[string]any) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.clientset.CoreV1().Pods(r.namespace).Patch(ctx, r.podName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (r *Registry) Lookup(ctx context.Context, name, id string) (*component.ServiceEntry, error) {
 	s, err := r.Browse(ctx, name)
 	if err != nil {
 		return nil, err
@@ -98,74 +207,194 @@ func (r *Registry) Lookup(ctx context.Context, name, id string) (se *component.S
 			return &s.Entries[i], nil
 		}
 	}
-	return nil, fmt.Errorf("not found")
+	return nil, fmt.Errorf("service %s/%s not found", name, id)
 }
 
 func (r *Registry) Browse(ctx context.Context, name string) (*component.Service, error) {
-	endpoints, err := r.clientset.CoreV1().Endpoints(r.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err := r.start(ctx); err != nil {
+		return nil, err
+	}
+	return r.buildService(name)
+}
+
+// buildService 根据缓存中的EndpointSlice、Pod和Service构建服务信息
+func (r *Registry) buildService(name string) (*component.Service, error) {
+	items, err := r.sliceLister.EndpointSlices(r.namespace).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: name,
+	}))
 	if err != nil {
 		return nil, err
 	}
-	serviceEntries := map[string]component.ServiceEntry{}
-	for i := range endpoints.Subsets {
-		for j := range endpoints.Subsets[i].Addresses {
-			id := endpoints.Subsets[i].Addresses[j].IP
-			if _, ok := serviceEntries[id]; !ok {
-				serviceEntries[id] = component.ServiceEntry{
-					ID:        id,
-					Alias:     endpoints.Annotations["alias"],
-					Version:   endpoints.Annotations["version"],
-					Endpoints: make([]string, 0, len(endpoints.Subsets[i].Ports)),
-				}
+	entries := map[string]*component.ServiceEntry{}
+	for _, slice := range items {
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
 			}
-			entry := serviceEntries[id]
-			for k := range endpoints.Subsets[i].Ports {
-				entry.Endpoints = append(entry.Endpoints, fmt.Sprintf("%s+%s://%s:%d",
-					endpoints.Subsets[i].Ports[k].Name,
-					strings.ToLower(string(endpoints.Subsets[i].Ports[k].Protocol)),
-					endpoints.Subsets[i].Addresses[j].IP,
-					endpoints.Subsets[i].Ports[k].Port),
-				)
+			for _, address := range ep.Addresses {
+				entry := r.entryFor(name, ep, address, entries)
+				for _, port := range slice.Ports {
+					if port.Port == nil {
+						continue
+					}
+					schema := "tcp"
+					if port.Name != nil && *port.Name != "" {
+						schema = *port.Name
+					}
+					endpoint := fmt.Sprintf("%s://%s:%d", schema, address, *port.Port)
+					if !slices.Contains(entry.Endpoints, endpoint) {
+						entry.Endpoints = append(entry.Endpoints, endpoint)
+					}
+				}
 			}
-			serviceEntries[id] = entry
 		}
 	}
 	s := &component.Service{
-		Entries: make([]component.ServiceEntry, 0, len(serviceEntries)),
+		Entries: make([]component.ServiceEntry, 0, len(entries)),
+		Configs: r.serviceConfigs(name),
 	}
-	for id := range serviceEntries {
-		s.Entries = append(s.Entries, serviceEntries[id])
+	for _, entry := range entries {
+		slices.Sort(entry.Endpoints)
+		s.Entries = append(s.Entries, *entry)
 	}
+	slices.SortFunc(s.Entries, func(a, b component.ServiceEntry) int {
+		return strings.Compare(a.ID, b.ID)
+	})
 	return s, nil
 }
 
-func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
-	w, err := r.clientset.CoreV1().Endpoints(r.namespace).Watch(ctx, metav1.ListOptions{
-		FieldSelector: fmt.Sprintf("metadata.name=%s", name),
+// entryFor 返回地址对应的服务实例，同一个pod的多个地址属于同一个实例
+func (r *Registry) entryFor(name string, ep discoveryv1.Endpoint, address string, entries map[string]*component.ServiceEntry) *component.ServiceEntry {
+	key := address
+	var pod *corev1.Pod
+	if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+		key = ep.TargetRef.Name
+		if p, err := r.podLister.Pods(r.namespace).Get(ep.TargetRef.Name); err == nil {
+			pod = p
+		} else if !apierrors.IsNotFound(err) {
+			r.logger.Warn("get pod error", "pod", ep.TargetRef.Name, "error", err)
+		}
+	}
+	if entry, ok := entries[key]; ok {
+		return entry
+	}
+	entry := &component.ServiceEntry{
+		ID:       key,
+		Name:     name,
+		Metadata: map[string]string{},
+	}
+	if pod != nil {
+		for k, v := range pod.Labels {
+			entry.Metadata[k] = v
+		}
+		entry.Version = pod.Labels[labelVersion]
+		if id := pod.Annotations[annotationID]; id != "" {
+			entry.ID = id
+		}
+		if alias := pod.Annotations[annotationAlias]; alias != "" {
+			entry.Alias = alias
+		}
+		if version := pod.Annotations[annotationVersion]; version != "" {
+			entry.Version = version
+		}
+		if raw := pod.Annotations[annotationMetadata]; raw != "" {
+			var md map[string]string
+			if err := json.Unmarshal([]byte(raw), &md); err != nil {
+				r.logger.Warn("invalid metadata annotation", "pod", pod.Name, "error", err)
+			}
+			for k, v := range md {
+				entry.Metadata[k] = v
+			}
+		}
+	}
+	entries[key] = entry
+	return entry
+}
+
+func (r *Registry) serviceConfigs(name string) []component.ConfigItem {
+	svc, err := r.serviceLister.Services(r.namespace).Get(name)
+	if err != nil {
+		return nil
+	}
+	var configs []component.ConfigItem
+	for k, v := range svc.Annotations {
+		if key, ok := strings.CutPrefix(k, annotationConfigPrefix); ok {
+			configs = append(configs, component.ConfigItem{Key: key, Value: v})
+		}
+	}
+	slices.SortFunc(configs, func(a, b component.ConfigItem) int {
+		return strings.Compare(a.Key, b.Key)
 	})
-	resultChan := w.ResultChan()
-	return component.StreamFunc[*component.Service](func(stop bool) (*component.Service, error) {
-		if stop {
-			w.Stop()
-			return nil, nil
+	return configs
+}
+
+func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &serviceWatcher{
+		Registry: r,
+		name:     name,
+		ctx:      ctx,
+		cancel:   cancel,
+		changed:  make(chan struct{}, 1),
+	}
+	r.watchersMux.Lock()
+	r.watchers[w] = struct{}{}
+	r.watchersMux.Unlock()
+	return w
+}
+
+func (r *Registry) notifyWatchers() {
+	r.watchersMux.Lock()
+	defer r.watchersMux.Unlock()
+	for w := range r.watchers {
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close 停止所有informer
+func (r *Registry) Close() {
+	close(r.stop)
+	r.factory.Shutdown()
+}
+
+type serviceWatcher struct {
+	*Registry
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed chan struct{}
+
+	last *component.Service
+}
+
+// Next 第一次调用返回当前服务信息，之后在服务信息变化时返回
+func (w *serviceWatcher) Next() (*component.Service, error) {
+	for {
+		if w.last != nil {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case <-w.changed:
+			}
 		}
+		s, err := w.Browse(w.ctx, w.name)
 		if err != nil {
-			defer func() { err = nil }()
 			return nil, err
 		}
-		select {
-		case <-ctx.Done():
-			w.Stop()
-			return nil, ctx.Err()
-		case event := <-resultChan:
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				ep, ok := event.Object.(*corev1.Endpoints)
-				fmt.Println(ep, ok)
-			case watch.Deleted:
-				fmt.Println("delete", event.Object)
-			}
+		if w.last != nil && reflect.DeepEqual(w.last, s) {
+			continue
 		}
-		return nil, nil
-	})
+		w.last = s
+		return s, nil
+	}
+}
+
+func (w *serviceWatcher) Stop() {
+	w.cancel()
+	w.watchersMux.Lock()
+	delete(w.watchers, w)
+	w.watchersMux.Unlock()
 }
@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestDiscovery(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-0",
+			Namespace: "test",
+			Labels:    map[string]string{"app": "app", labelVersion: "v1.0.0"},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "test",
+			Annotations: map[string]string{annotationConfigPrefix + "LoadBalancingConfig": "round_robin"},
+		},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-abc",
+			Namespace: "test",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "app"},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: ptr(true)},
+				TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: "app-0"},
+			},
+			{
+				Addresses:  []string{"10.0.0.2"},
+				Conditions: discoveryv1.EndpointConditions{Ready: ptr(false)},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{{Name: ptr("grpc"), Port: ptr(int32(8090))}},
+	}
+	clientset := fake.NewSimpleClientset(pod, svc, slice)
+	r := NewRegistry(clientset, "test", "app-0", logx.GetLogger("test"))
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := r.Watch(ctx, "app")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 || s.Entries[0].ID != "app-0" || s.Entries[0].Version != "v1.0.0" ||
+		s.Entries[0].Endpoints[0] != "grpc://10.0.0.1:8090" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	if len(s.Configs) != 1 || s.Configs[0].Key != "LoadBalancingConfig" {
+		t.Fatalf("unexpected configs %+v", s.Configs)
+	}
+
+	err = r.Register(ctx, component.ServiceEntry{
+		ID:       "uuid-0",
+		Name:     "app",
+		Version:  "v1.1.0",
+		Metadata: map[string]string{"group": "gray"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := s.Entries[0]
+	if entry.ID != "uuid-0" || entry.Version != "v1.1.0" || entry.Metadata["group"] != "gray" || entry.Metadata["app"] != "app" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	if err := r.Deregister(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Entries[0].ID != "app-0" {
+		t.Fatalf("unexpected entry %+v", s.Entries[0])
+	}
+}
@@ -0,0 +1,50 @@
+package nacos
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+)
+
+const Name = "nacos"
+
+// clientOptions nacos配置和服务发现通用的连接参数
+type clientOptions struct {
+	constant.ClientConfig
+	serverAddrs string
+}
+
+func (c *clientOptions) AddFlags(fs *flag.FlagSet) {
+	fs.Uint64Var(&c.TimeoutMs, "timeout_ms", 10000, "timeout for requesting Nacos server, default value is")
+	fs.StringVar(&c.NamespaceId, "namespace_id", "", "the namespaceId of Nacos")
+	fs.StringVar(&c.Endpoint, "endpoint", "", "the endpoint for ACM. https://help.aliyun.com/document_detail/130146.html")
+	fs.StringVar(&c.RegionId, "region_id", "", "the regionId for ACM & KMS")
+	fs.StringVar(&c.AccessKey, "access_key", "", "the accessKey for ACM & KMS")
+	fs.StringVar(&c.SecretKey, "secret_key", "", "the secretKey for ACM & KMS")
+	fs.BoolVar(&c.OpenKMS, "open_kms", false, `it's to open KMS, default is false. https://help.aliyun.com/product/28933.html, to enable encrypt/decrypt, DataId should be start with "cipher-"`)
+	fs.StringVar(&c.CacheDir, "cache_dir", "", "the directory for persist nacos service info,default value is current path")
+	fs.StringVar(&c.Username, "username", "", "the username for nacos auth")
+	fs.StringVar(&c.Password, "password", "", "the password for nacos auth")
+	fs.StringVar(&c.LogDir, "log_dir", "", "the directory for log, default is current path")
+	fs.StringVar(&c.serverAddrs, "server_addrs", "", "the server address for nacos")
+}
+
+// serverConfigs 解析server_addrs，形如：127.0.0.1:8848,127.0.0.2:8848
+func (c *clientOptions) serverConfigs() ([]constant.ServerConfig, error) {
+	var sc []constant.ServerConfig
+	for _, addr := range strings.Split(c.serverAddrs, ",") {
+		ipPort := strings.SplitN(addr, ":", 2)
+		if len(ipPort) != 2 {
+			return nil, fmt.Errorf("invalid server address %s", addr)
+		}
+		port, err := strconv.Atoi(ipPort[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid server address %s", addr)
+		}
+		sc = append(sc, *constant.NewServerConfig(ipPort[0], uint64(port)))
+	}
+	return sc, nil
+}
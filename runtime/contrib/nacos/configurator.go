@@ -2,10 +2,8 @@ package nacos
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 	"sync"
 
@@ -15,60 +13,32 @@ import (
 	"github.com/daemtri/begonia/runtime/component"
 	"github.com/nacos-group/nacos-sdk-go/v2/clients"
 	"github.com/nacos-group/nacos-sdk-go/v2/clients/config_client"
-	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
 	"github.com/nacos-group/nacos-sdk-go/v2/vo"
 	"sigs.k8s.io/yaml"
 )
 
-const Name = "nacos"
-
 func init() {
 	component.Register[component.Configurator](Name, &ConfiguratorBootloader{})
 }
 
 type ConfiguratorBootloader struct {
-	constant.ClientConfig
-	instance    Configurator
-	serverAddrs string
+	clientOptions
+	instance Configurator
 }
 
 func (c *ConfiguratorBootloader) Destroy() error {
 	return c.instance.close()
 }
 
-func (c *ConfiguratorBootloader) AddFlags(fs *flag.FlagSet) {
-	fs.Uint64Var(&c.TimeoutMs, "timeout_ms", 10000, "timeout for requesting Nacos server, default value is")
-	fs.StringVar(&c.NamespaceId, "namespace_id", "", "the namespaceId of Nacos")
-	fs.StringVar(&c.Endpoint, "endpoint", "", "the endpoint for ACM. https://help.aliyun.com/document_detail/130146.html")
-	fs.StringVar(&c.RegionId, "region_id", "", "the regionId for ACM & KMS")
-	fs.StringVar(&c.AccessKey, "access_key", "", "the accessKey for ACM & KMS")
-	fs.StringVar(&c.SecretKey, "secret_key", "", "the secretKey for ACM & KMS")
-	fs.BoolVar(&c.OpenKMS, "open_kms", false, `it's to open KMS, default is false. https://help.aliyun.com/product/28933.html, to enable encrypt/decrypt, DataId should be start with "cipher-"`)
-	fs.StringVar(&c.CacheDir, "cache_dir", "", "the directory for persist nacos service info,default value is current path")
-	fs.StringVar(&c.Username, "username", "", "the username for nacos auth")
-	fs.StringVar(&c.Password, "password", "", "the password for nacos auth")
-	fs.StringVar(&c.LogDir, "log_dir", "", "the directory for log, default is current path")
-	fs.StringVar(&c.serverAddrs, "server_addrs", "", "the server address for nacos")
-}
-
 func (c *ConfiguratorBootloader) ValidateFlags() error {
 	return validate.Struct(c)
 }
 
 func (c *ConfiguratorBootloader) Boot(logger *slog.Logger) error {
 	c.instance.log = logger
-	var sc []constant.ServerConfig
-	serverAddrs := strings.Split(c.serverAddrs, ",")
-	for _, addr := range serverAddrs {
-		ipPort := strings.SplitN(addr, ":", 2)
-		if len(ipPort) != 2 {
-			panic(fmt.Errorf("invalid server address %s", addr))
-		}
-		port, err := strconv.Atoi(ipPort[1])
-		if err != nil {
-			panic(fmt.Errorf("invalid server address %s", addr))
-		}
-		sc = append(sc, *constant.NewServerConfig(ipPort[0], uint64(port)))
+	sc, err := c.serverConfigs()
+	if err != nil {
+		return err
 	}
 	client, err := clients.NewConfigClient(
 		vo.NacosClientParam{
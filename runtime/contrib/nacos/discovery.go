@@ -0,0 +1,418 @@
+package nacos
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+)
+
+const (
+	// 注册到nacos实例元数据中的保留字段，读取时会从Metadata中移除
+	metadataID      = "begonia.id"
+	metadataAlias   = "begonia.alias"
+	metadataVersion = "begonia.version"
+	metadataSchema  = "begonia.schema"
+)
+
+func init() {
+	component.Register[component.Discovery](Name, &DiscoveryBootloader{})
+}
+
+type DiscoveryBootloader struct {
+	clientOptions
+	group         string
+	configRefresh time.Duration
+
+	reg *Registry
+}
+
+func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
+	d.clientOptions.AddFlags(fs)
+	fs.StringVar(&d.group, "group", "DEFAULT_GROUP", "服务注册的nacos分组")
+	fs.DurationVar(&d.configRefresh, "config_refresh", 30*time.Second, "服务元数据(服务配置)的刷新间隔")
+}
+
+func (d *DiscoveryBootloader) ValidateFlags() error {
+	if strings.TrimSpace(d.serverAddrs) == "" {
+		return fmt.Errorf("nacos server_addrs is empty")
+	}
+	if d.configRefresh <= 0 {
+		return fmt.Errorf("nacos config_refresh must be positive, got %s", d.configRefresh)
+	}
+	return nil
+}
+
+func (d *DiscoveryBootloader) Boot(logger *logx.Logger) error {
+	sc, err := d.serverConfigs()
+	if err != nil {
+		return err
+	}
+	client, err := clients.NewNamingClient(vo.NacosClientParam{
+		ClientConfig:  &d.ClientConfig,
+		ServerConfigs: sc,
+	})
+	if err != nil {
+		return fmt.Errorf("create nacos naming client error: %w", err)
+	}
+	fetcher := newOpenAPIClient(sc, d.ClientConfig)
+	d.reg = NewRegistry(client, fetcher, d.group, d.configRefresh, logger)
+	return nil
+}
+
+func (d *DiscoveryBootloader) Retrofit() error {
+	return nil
+}
+
+func (d *DiscoveryBootloader) Instance() component.Discovery {
+	return d.reg
+}
+
+func (d *DiscoveryBootloader) Destroy() error {
+	d.reg.Close()
+	return nil
+}
+
+// ServiceMetadataFetcher 读取nacos服务级别的元数据，naming client只能获取实例信息
+type ServiceMetadataFetcher interface {
+	ServiceMetadata(ctx context.Context, service, group string) (map[string]string, error)
+}
+
+// Registry 基于nacos naming的服务注册发现
+// ServiceEntry的每个endpoint注册为一个临时实例，心跳由sdk维护，ID、Alias、Version和schema保存在实例元数据中
+// 服务级别的元数据作为服务配置，如：LoadBalancingConfig: round_robin
+type Registry struct {
+	client  naming_client.INamingClient
+	fetcher ServiceMetadataFetcher
+	group   string
+	refresh time.Duration
+	logger  *logx.Logger
+}
+
+func NewRegistry(client naming_client.INamingClient, fetcher ServiceMetadataFetcher, group string, refresh time.Duration, logger *logx.Logger) *Registry {
+	return &Registry{
+		client:  client,
+		fetcher: fetcher,
+		group:   group,
+		refresh: refresh,
+		logger:  logger,
+	}
+}
+
+func (r *Registry) Register(ctx context.Context, service component.ServiceEntry) error {
+	instances, err := toInstances(service)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		return fmt.Errorf("service %s has no endpoints", service.Name)
+	}
+	ok, err := r.client.BatchRegisterInstance(vo.BatchRegisterInstanceParam{
+		ServiceName: service.Name,
+		GroupName:   r.group,
+		Instances:   instances,
+	})
+	if err != nil {
+		return fmt.Errorf("register nacos instance error: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("register nacos instance %s/%s failed", service.Name, service.ID)
+	}
+	r.logger.Info("register", "service", service)
+	return nil
+}
+
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	instances, err := toInstances(service)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, ins := range instances {
+		_, err := r.client.DeregisterInstance(vo.DeregisterInstanceParam{
+			Ip:          ins.Ip,
+			Port:        ins.Port,
+			ServiceName: service.Name,
+			GroupName:   r.group,
+			Ephemeral:   true,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deregister nacos instance %s:%d error: %w", ins.Ip, ins.Port, err))
+		}
+	}
+	r.logger.Info("deregister", "service", service)
+	return errors.Join(errs...)
+}
+
+// toInstances 将ServiceEntry的endpoint转换为nacos实例，endpoint形如：grpc://127.0.0.1:8090
+func toInstances(service component.ServiceEntry) ([]vo.RegisterInstanceParam, error) {
+	instances := make([]vo.RegisterInstanceParam, 0, len(service.Endpoints))
+	for _, endpoint := range service.Endpoints {
+		schema, addr, ok := strings.Cut(endpoint, "://")
+		if !ok {
+			schema, addr = "", endpoint
+		}
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+		}
+		md := make(map[string]string, len(service.Metadata)+4)
+		for k, v := range service.Metadata {
+			md[k] = v
+		}
+		md[metadataID] = service.ID
+		md[metadataAlias] = service.Alias
+		md[metadataVersion] = service.Version
+		md[metadataSchema] = schema
+		instances = append(instances, vo.RegisterInstanceParam{
+			Ip:          host,
+			Port:        port,
+			Weight:      1,
+			Enable:      true,
+			Healthy:     true,
+			Metadata:    md,
+			ServiceName: service.Name,
+			Ephemeral:   true,
+		})
+	}
+	return instances, nil
+}
+
+// toEntries 将nacos实例按ID聚合为ServiceEntry，忽略不健康、禁用和权重为0的实例
+func toEntries(name string, instances []model.Instance) []component.ServiceEntry {
+	entries := map[string]*component.ServiceEntry{}
+	for _, ins := range instances {
+		if !ins.Healthy || !ins.Enable || ins.Weight <= 0 {
+			continue
+		}
+		id := ins.Metadata[metadataID]
+		if id == "" {
+			id = net.JoinHostPort(ins.Ip, strconv.FormatUint(ins.Port, 10))
+		}
+		entry, ok := entries[id]
+		if !ok {
+			entry = &component.ServiceEntry{
+				ID:       id,
+				Name:     name,
+				Alias:    ins.Metadata[metadataAlias],
+				Version:  ins.Metadata[metadataVersion],
+				Metadata: map[string]string{},
+			}
+			for k, v := range ins.Metadata {
+				if !strings.HasPrefix(k, "begonia.") {
+					entry.Metadata[k] = v
+				}
+			}
+			entries[id] = entry
+		}
+		endpoint := net.JoinHostPort(ins.Ip, strconv.FormatUint(ins.Port, 10))
+		if schema := ins.Metadata[metadataSchema]; schema != "" {
+			endpoint = schema + "://" + endpoint
+		}
+		entry.Endpoints = append(entry.Endpoints, endpoint)
+	}
+	ret := make([]component.ServiceEntry, 0, len(entries))
+	for _, entry := range entries {
+		slices.Sort(entry.Endpoints)
+		ret = append(ret, *entry)
+	}
+	slices.SortFunc(ret, func(a, b component.ServiceEntry) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return ret
+}
+
+func (r *Registry) serviceConfigs(ctx context.Context, name string) ([]component.ConfigItem, error) {
+	if r.fetcher == nil {
+		return nil, nil
+	}
+	md, err := r.fetcher.ServiceMetadata(ctx, name, r.group)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]component.ConfigItem, 0, len(md))
+	for k, v := range md {
+		configs = append(configs, component.ConfigItem{Key: k, Value: v})
+	}
+	slices.SortFunc(configs, func(a, b component.ConfigItem) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return configs, nil
+}
+
+func (r *Registry) Lookup(ctx context.Context, name, id string) (*component.ServiceEntry, error) {
+	s, err := r.Browse(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Entries {
+		if s.Entries[i].ID == id {
+			return &s.Entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service %s/%s not found", name, id)
+}
+
+func (r *Registry) Browse(ctx context.Context, name string) (*component.Service, error) {
+	instances, err := r.client.SelectAllInstances(vo.SelectAllInstancesParam{
+		ServiceName: name,
+		GroupName:   r.group,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("select nacos instances of %s error: %w", name, err)
+	}
+	configs, err := r.serviceConfigs(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("get nacos service metadata of %s error: %w", name, err)
+	}
+	return &component.Service{Entries: toEntries(name, instances), Configs: configs}, nil
+}
+
+func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &serviceWatcher{
+		Registry: r,
+		name:     name,
+		ctx:      ctx,
+		cancel:   cancel,
+		changed:  make(chan []model.Instance, 1),
+	}
+	w.param = &vo.SubscribeParam{
+		ServiceName:       name,
+		GroupName:         r.group,
+		SubscribeCallback: w.onChange,
+	}
+	return w
+}
+
+// Close 关闭naming client，sdk会停止心跳
+func (r *Registry) Close() {
+	r.client.CloseClient()
+}
+
+type serviceWatcher struct {
+	*Registry
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	param   *vo.SubscribeParam
+	changed chan []model.Instance
+
+	// mux 保护initialized和ticker，Stop可能和Next并发调用
+	mux         sync.Mutex
+	initialized bool
+	ticker      *time.Ticker
+	instances   []model.Instance
+	last        *component.Service
+}
+
+// onChange nacos订阅回调，只保留最新的实例列表
+func (w *serviceWatcher) onChange(instances []model.Instance, err error) {
+	if err != nil {
+		w.logger.Warn("nacos subscribe callback error", "service", w.name, "error", err)
+		return
+	}
+	for {
+		select {
+		case w.changed <- instances:
+			return
+		default:
+		}
+		select {
+		case <-w.changed:
+		default:
+		}
+	}
+}
+
+// init 订阅服务并读取当前实例列表，失败时取消订阅，下次调用Next时重试
+func (w *serviceWatcher) init() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.initialized {
+		return nil
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.client.Subscribe(w.param); err != nil {
+		return fmt.Errorf("subscribe nacos service %s error: %w", w.name, err)
+	}
+	instances, err := w.client.SelectAllInstances(vo.SelectAllInstancesParam{
+		ServiceName: w.name,
+		GroupName:   w.group,
+	})
+	if err != nil {
+		if err := w.client.Unsubscribe(w.param); err != nil {
+			w.logger.Warn("unsubscribe nacos service error", "service", w.name, "error", err)
+		}
+		return fmt.Errorf("select nacos instances of %s error: %w", w.name, err)
+	}
+	w.instances = instances
+	w.ticker = time.NewTicker(w.refresh)
+	w.initialized = true
+	return nil
+}
+
+// Next 第一次调用返回当前服务信息，之后在实例变化或服务配置刷新后有变化时返回
+func (w *serviceWatcher) Next() (*component.Service, error) {
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	for {
+		if w.last != nil {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case w.instances = <-w.changed:
+			case <-w.ticker.C:
+			}
+		}
+		configs, err := w.serviceConfigs(w.ctx, w.name)
+		if err != nil {
+			if w.last == nil {
+				return nil, fmt.Errorf("get nacos service metadata of %s error: %w", w.name, err)
+			}
+			// 服务配置读取失败时沿用上一次的配置
+			w.logger.Warn("get nacos service metadata error", "service", w.name, "error", err)
+			configs = w.last.Configs
+		}
+		s := &component.Service{Entries: toEntries(w.name, w.instances), Configs: configs}
+		if w.last != nil && reflect.DeepEqual(w.last, s) {
+			continue
+		}
+		w.last = s
+		return s, nil
+	}
+}
+
+func (w *serviceWatcher) Stop() {
+	w.cancel()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if !w.initialized {
+		return
+	}
+	w.ticker.Stop()
+	if err := w.client.Unsubscribe(w.param); err != nil {
+		w.logger.Warn("unsubscribe nacos service error", "service", w.name, "error", err)
+	}
+}
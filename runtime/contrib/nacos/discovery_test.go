@@ -0,0 +1,201 @@
+package nacos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+)
+
+type fakeNamingClient struct {
+	naming_client.INamingClient
+
+	mux          sync.Mutex
+	instances    []model.Instance
+	callbacks    []func([]model.Instance, error)
+	subscribeErr error
+	selectErr    error
+	subscribed   int
+}
+
+func (f *fakeNamingClient) BatchRegisterInstance(param vo.BatchRegisterInstanceParam) (bool, error) {
+	f.mux.Lock()
+	for _, ins := range param.Instances {
+		f.instances = append(f.instances, model.Instance{
+			Ip: ins.Ip, Port: ins.Port, Weight: ins.Weight, Healthy: ins.Healthy,
+			Enable: ins.Enable, Metadata: ins.Metadata,
+		})
+	}
+	f.mux.Unlock()
+	f.notify()
+	return true, nil
+}
+
+func (f *fakeNamingClient) DeregisterInstance(param vo.DeregisterInstanceParam) (bool, error) {
+	f.mux.Lock()
+	f.instances = nil
+	f.mux.Unlock()
+	f.notify()
+	return true, nil
+}
+
+func (f *fakeNamingClient) SelectAllInstances(param vo.SelectAllInstancesParam) ([]model.Instance, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.selectErr != nil {
+		return nil, f.selectErr
+	}
+	return append([]model.Instance(nil), f.instances...), nil
+}
+
+func (f *fakeNamingClient) Subscribe(param *vo.SubscribeParam) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.subscribeErr != nil {
+		return f.subscribeErr
+	}
+	f.subscribed++
+	f.callbacks = append(f.callbacks, param.SubscribeCallback)
+	return nil
+}
+
+func (f *fakeNamingClient) Unsubscribe(param *vo.SubscribeParam) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.subscribed--
+	return nil
+}
+
+func (f *fakeNamingClient) notify() {
+	f.mux.Lock()
+	instances := append([]model.Instance(nil), f.instances...)
+	callbacks := f.callbacks
+	f.mux.Unlock()
+	for _, cb := range callbacks {
+		cb(instances, nil)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nacos/v1/auth/login":
+			_, _ = w.Write([]byte(`{"accessToken":"token","tokenTtl":18000}`))
+		case "/nacos/v1/ns/service":
+			if r.URL.Query().Get("accessToken") != "token" || r.URL.Query().Get("serviceName") != "app" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"app","metadata":{"LoadBalancingConfig":"round_robin"}}`))
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.ParseUint(u.Port(), 10, 64)
+	fetcher := newOpenAPIClient(
+		[]constant.ServerConfig{*constant.NewServerConfig(u.Hostname(), port)},
+		constant.ClientConfig{Username: "nacos", Password: "nacos", TimeoutMs: 1000},
+	)
+
+	client := &fakeNamingClient{}
+	r := NewRegistry(client, fetcher, "DEFAULT_GROUP", time.Minute, logx.GetLogger("test"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := r.Watch(ctx, "app")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 || len(s.Configs) != 1 || s.Configs[0].Value != "round_robin" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+
+	entry := component.ServiceEntry{
+		ID:        "uuid-0",
+		Name:      "app",
+		Version:   "v1.0.0",
+		Endpoints: []string{"grpc://127.0.0.1:8090", "http://127.0.0.1:8080"},
+		Metadata:  map[string]string{"group": "gray"},
+	}
+	if err := r.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 {
+		t.Fatalf("unexpected entries %+v", s.Entries)
+	}
+	got := s.Entries[0]
+	if got.ID != "uuid-0" || got.Version != "v1.0.0" || got.Metadata["group"] != "gray" || len(got.Metadata) != 1 ||
+		len(got.Endpoints) != 2 || got.Endpoints[0] != "grpc://127.0.0.1:8090" {
+		t.Fatalf("unexpected entry %+v", got)
+	}
+
+	if err := r.Deregister(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 {
+		t.Fatalf("unexpected entries %+v", s.Entries)
+	}
+}
+
+func TestWatchRetrySubscribe(t *testing.T) {
+	client := &fakeNamingClient{subscribeErr: errors.New("nacos unavailable")}
+	r := NewRegistry(client, nil, "DEFAULT_GROUP", time.Minute, logx.GetLogger("test"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 订阅失败时返回错误，Stop不会panic
+	stream := r.Watch(ctx, "app")
+	if _, err := stream.Next(); err == nil {
+		t.Fatal("expected subscribe error")
+	}
+	stream.Stop()
+
+	// 每次调用Next都会重试订阅
+	stream = r.Watch(ctx, "app")
+	defer stream.Stop()
+	if _, err := stream.Next(); err == nil {
+		t.Fatal("expected subscribe error")
+	}
+	client.mux.Lock()
+	client.subscribeErr = nil
+	client.selectErr = errors.New("select failed")
+	client.mux.Unlock()
+	if _, err := stream.Next(); err == nil {
+		t.Fatal("expected select error")
+	}
+	if client.subscribed != 0 {
+		t.Fatalf("should unsubscribe after select error, subscribed %d", client.subscribed)
+	}
+	client.mux.Lock()
+	client.selectErr = nil
+	client.mux.Unlock()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 || client.subscribed != 1 {
+		t.Fatalf("unexpected service %+v, subscribed %d", s, client.subscribed)
+	}
+}
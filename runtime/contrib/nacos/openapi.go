@@ -0,0 +1,137 @@
+package nacos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+)
+
+// openAPIClient 通过nacos open api读取服务元数据
+// see: https://nacos.io/zh-cn/docs/open-api.html
+type openAPIClient struct {
+	servers     []constant.ServerConfig
+	namespaceID string
+	username    string
+	password    string
+	httpClient  *http.Client
+
+	mux         sync.Mutex
+	accessToken string
+	expireAt    time.Time
+}
+
+func newOpenAPIClient(servers []constant.ServerConfig, cc constant.ClientConfig) *openAPIClient {
+	return &openAPIClient{
+		servers:     servers,
+		namespaceID: cc.NamespaceId,
+		username:    cc.Username,
+		password:    cc.Password,
+		httpClient:  &http.Client{Timeout: time.Duration(cc.TimeoutMs) * time.Millisecond},
+	}
+}
+
+func (c *openAPIClient) ServiceMetadata(ctx context.Context, service, group string) (map[string]string, error) {
+	var errs []error
+	for _, server := range c.servers {
+		md, err := c.serviceMetadata(ctx, server, service, group)
+		if err == nil {
+			return md, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *openAPIClient) serviceMetadata(ctx context.Context, server constant.ServerConfig, service, group string) (map[string]string, error) {
+	query := url.Values{}
+	query.Set("serviceName", service)
+	query.Set("groupName", group)
+	if c.namespaceID != "" {
+		query.Set("namespaceId", c.namespaceID)
+	}
+	if c.username != "" {
+		token, err := c.token(ctx, server)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("accessToken", token)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL(server, "/v1/ns/service")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := c.do(req, &ret); err != nil {
+		return nil, err
+	}
+	return ret.Metadata, nil
+}
+
+// token 登录并缓存accessToken，提前一分钟刷新
+func (c *openAPIClient) token(ctx context.Context, server constant.ServerConfig) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.accessToken != "" && time.Now().Before(c.expireAt) {
+		return c.accessToken, nil
+	}
+	form := url.Values{}
+	form.Set("username", c.username)
+	form.Set("password", c.password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL(server, "/v1/auth/login"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var ret struct {
+		AccessToken string `json:"accessToken"`
+		TokenTTL    int64  `json:"tokenTtl"`
+	}
+	if err := c.do(req, &ret); err != nil {
+		return "", fmt.Errorf("nacos login error: %w", err)
+	}
+	c.accessToken = ret.AccessToken
+	c.expireAt = time.Now().Add(time.Duration(ret.TokenTTL)*time.Second - time.Minute)
+	return c.accessToken, nil
+}
+
+func (c *openAPIClient) do(req *http.Request, v any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nacos %s %s: %s", req.Method, req.URL.Path, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+func serverURL(server constant.ServerConfig, path string) string {
+	scheme := server.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	contextPath := server.ContextPath
+	if contextPath == "" {
+		contextPath = "/nacos"
+	}
+	host := net.JoinHostPort(server.IpAddr, strconv.FormatUint(server.Port, 10))
+	return scheme + "://" + host + strings.TrimSuffix(contextPath, "/") + path
+}
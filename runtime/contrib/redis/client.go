@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"flag"
+	"sync"
+
+	"github.com/daemtri/begonia/driver/redis"
+)
+
+// clientOptions redis驱动通用的连接参数
+type clientOptions struct {
+	addr     string
+	db       int
+	username string
+	password string
+}
+
+func (o *clientOptions) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "addr", "127.0.0.1:6379", "redis addr")
+	fs.IntVar(&o.db, "db", 0, "redis db")
+	fs.StringVar(&o.username, "username", "", "redis username")
+	fs.StringVar(&o.password, "password", "", "redis password")
+}
+
+// sharedClient 相同连接参数的组件共用的客户端
+type sharedClient struct {
+	client *redis.Redis
+	refs   int
+}
+
+var (
+	clientsMux sync.Mutex
+	clients    = map[clientOptions]*sharedClient{}
+)
+
+// acquireClient 返回相同连接参数共用的客户端，DistrubutedLocker和Concurrency连接同一个redis时只创建一个连接池
+func (o *clientOptions) acquireClient() (*redis.Redis, error) {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+	if sc, ok := clients[*o]; ok {
+		sc.refs++
+		return sc.client, nil
+	}
+	client, err := redis.NewRedis(context.Background(), &redis.Options{
+		Addr:     o.addr,
+		DB:       o.db,
+		Username: o.username,
+		Password: o.password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clients[*o] = &sharedClient{client: client, refs: 1}
+	return client, nil
+}
+
+// releaseClient 释放acquireClient返回的客户端，最后一个使用者释放时关闭
+func (o *clientOptions) releaseClient() error {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+	sc, ok := clients[*o]
+	if !ok {
+		return nil
+	}
+	if sc.refs--; sc.refs > 0 {
+		return nil
+	}
+	delete(clients, *o)
+	return sc.client.Close()
+}
@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daemtri/begonia/driver/redis"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime"
+	"github.com/daemtri/begonia/runtime/component"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/segmentio/ksuid"
+)
+
+// ErrSessionExpired 会话已过期或已关闭
+var ErrSessionExpired = errors.New("redis session expired")
+
+// refreshScript KEYS[1]=会话 KEYS[2:]=会话持有的锁 ARGV[1]=会话id ARGV[2]=ttl毫秒，返回成功续约的key数量
+// 会话已经过期时不再续约锁，返回0
+var refreshScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local n = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("GET", key) == ARGV[1] then
+		redis.call("PEXPIRE", key, ARGV[2])
+		n = n + 1
+	end
+end
+return n`)
+
+// releaseScript KEYS=需要释放的key ARGV[1]=会话id，返回成功释放的key数量
+var releaseScript = goredis.NewScript(`
+local n = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("GET", key) == ARGV[1] then
+		redis.call("DEL", key)
+		n = n + 1
+	end
+end
+return n`)
+
+// lockScript KEYS[1]=锁 KEYS[2]=fencing token ARGV[1]=会话id ARGV[2]=ttl毫秒
+// 加锁成功返回递增后的fencing token，锁被其他会话持有时返回0
+var lockScript = goredis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0`)
+
+func init() {
+	component.Register[component.Concurrency](Name, &ConcurrencyBootloader{})
+}
+
+type ConcurrencyBootloader struct {
+	clientOptions
+
+	instance *Concurrency
+}
+
+func (c *ConcurrencyBootloader) ValidateFlags() error {
+	return nil
+}
+
+func (c *ConcurrencyBootloader) Boot(logger *logx.Logger) error {
+	client, err := c.acquireClient()
+	if err != nil {
+		return err
+	}
+	c.instance = NewConcurrency(client, logger)
+	return nil
+}
+
+func (c *ConcurrencyBootloader) Retrofit() error {
+	return nil
+}
+
+func (c *ConcurrencyBootloader) Instance() component.Concurrency {
+	return c.instance
+}
+
+func (c *ConcurrencyBootloader) Destroy() error {
+	return c.releaseClient()
+}
+
+// Concurrency 基于redis过期时间的会话和互斥锁
+// 会话保存在 app:session:{id}，锁保存在 app:mutex:{namespace}:{pfx}，值都为会话id
+// 会话每ttl/3续约一次，同时续约会话持有的所有锁，续约失败超过ttl后会话过期
+type Concurrency struct {
+	client *redis.Redis
+	logger *logx.Logger
+}
+
+func NewConcurrency(client *redis.Redis, logger *logx.Logger) *Concurrency {
+	return &Concurrency{client: client, logger: logger}
+}
+
+func (c *Concurrency) NewSession(ctx context.Context, ttl time.Duration) (component.Session, error) {
+	s := &session{
+		Concurrency: c,
+		id:          fmt.Sprintf("%s:%s:%s", runtime.GetServiceName(), runtime.GetServiceID(), ksuid.New()),
+		ttl:         ttl,
+		held:        make(map[string]struct{}),
+		done:        make(chan struct{}),
+		stop:        make(chan struct{}),
+	}
+	ok, err := c.client.SetNX(ctx, s.key(), s.id, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("session %s already exists", s.id)
+	}
+	go s.keepAlive(ctx)
+	return s, nil
+}
+
+type session struct {
+	*Concurrency
+	id  string
+	ttl time.Duration
+
+	mux  sync.Mutex
+	held map[string]struct{}
+
+	done      chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *session) key() string {
+	return "app:session:" + s.id
+}
+
+func (s *session) keepAlive(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(max(s.ttl/3, 10*time.Millisecond))
+	defer ticker.Stop()
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			s.release()
+			return
+		case <-s.stop:
+			s.release()
+			return
+		case <-ticker.C:
+		}
+		keys := s.keys()
+		n, err := refreshScript.Run(context.Background(), s.client, keys, s.id, s.ttl.Milliseconds()).Int()
+		if err != nil {
+			s.logger.Warn("renew session error", "session", s.id, "error", err)
+			if time.Since(lastRenewal) < s.ttl {
+				continue
+			}
+			s.logger.Error("session expired", "session", s.id)
+			return
+		}
+		if n == 0 {
+			// 会话key已经不存在，说明会话已过期
+			s.logger.Error("session expired", "session", s.id)
+			return
+		}
+		if n < len(keys) {
+			s.logger.Warn("some mutexes lost", "session", s.id, "held", len(keys)-1, "renewed", n-1)
+		}
+		lastRenewal = time.Now()
+	}
+}
+
+func (s *session) keys() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	keys := make([]string, 0, len(s.held)+1)
+	keys = append(keys, s.key())
+	for k := range s.held {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *session) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ttl)
+	defer cancel()
+	if err := releaseScript.Run(ctx, s.client, s.keys(), s.id).Err(); err != nil {
+		s.logger.Warn("release session error", "session", s.id, "error", err)
+	}
+}
+
+func (s *session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *session) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+func (s *session) NewMutex(pfx string) component.Mutex {
+	return &mutex{session: s, mutexKey: fmt.Sprintf("app:mutex:%s:%s", runtime.GetNamespace(), pfx)}
+}
+
+func (s *session) NewLocker(pfx string) sync.Locker {
+	return &locker{m: s.NewMutex(pfx)}
+}
+
+type mutex struct {
+	*session
+	mutexKey string
+	fence    int64
+}
+
+// Fence 加锁时在同一个脚本中对 {key}:fence 执行INCR得到fencing token
+func (m *mutex) Fence() int64 {
+	return m.fence
+}
+
+func (m *mutex) TryLock(ctx context.Context) error {
+	select {
+	case <-m.done:
+		return ErrSessionExpired
+	default:
+	}
+	fence, err := lockScript.Run(ctx, m.client, []string{m.mutexKey, m.mutexKey + ":fence"}, m.id, m.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if fence == 0 {
+		return component.ErrLocked
+	}
+	m.mux.Lock()
+	m.held[m.mutexKey] = struct{}{}
+	m.mux.Unlock()
+	m.fence = fence
+	return nil
+}
+
+func (m *mutex) Lock(ctx context.Context) error {
+	for {
+		err := m.TryLock(ctx)
+		if !errors.Is(err, component.ErrLocked) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.done:
+			return ErrSessionExpired
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	m.mux.Lock()
+	delete(m.held, m.mutexKey)
+	m.mux.Unlock()
+	n, err := releaseScript.Run(ctx, m.client, []string{m.mutexKey}, m.id).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("mutex %s is not held by session %s", m.mutexKey, m.id)
+	}
+	return nil
+}
+
+type locker struct {
+	m component.Mutex
+}
+
+func (l *locker) Lock() {
+	if err := l.m.Lock(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+func (l *locker) Unlock() {
+	if err := l.m.Unlock(context.Background()); err != nil {
+		panic(err)
+	}
+}
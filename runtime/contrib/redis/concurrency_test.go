@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daemtri/begonia/driver/redis"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime"
+	"github.com/daemtri/begonia/runtime/component"
+)
+
+func newTestConcurrency(t *testing.T) (*Concurrency, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewRedis(context.Background(), &redis.Options{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewConcurrency(client, logx.GetLogger("test")), mr
+}
+
+func TestMutex(t *testing.T) {
+	c, mr := newTestConcurrency(t)
+	ctx := context.Background()
+	s1, err := c.NewSession(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.NewSession(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+
+	m1, m2 := s1.NewMutex("job"), s2.NewMutex("job")
+	if err := m1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("app:mutex:" + runtime.GetNamespace() + ":job") {
+		t.Error("mutex key should contain the namespace")
+	}
+	if err := m2.TryLock(ctx); !errors.Is(err, component.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	// 关闭会话会释放会话持有的锁
+	if err := s1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s1.Done():
+	default:
+		t.Error("session should be done after close")
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := m2.Lock(lockCtx); err != nil {
+		t.Fatal(err)
+	}
+	if m1.Fence() != 1 || m2.Fence() != 2 {
+		t.Errorf("unexpected fences %d %d", m1.Fence(), m2.Fence())
+	}
+	if err := m2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	c, mr := newTestConcurrency(t)
+	s, err := c.NewSession(context.Background(), 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Second)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should expire")
+	}
+	if err := s.NewMutex("job").TryLock(context.Background()); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired, got %v", err)
+	}
+}
+
+func TestSessionLostWithMutex(t *testing.T) {
+	c, mr := newTestConcurrency(t)
+	ctx := context.Background()
+	s, err := c.NewSession(ctx, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.NewMutex("job").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 会话key丢失时即使锁还在也视为会话过期，不再续约锁
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "app:session:") {
+			mr.Del(key)
+		}
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session should expire")
+	}
+}
+
+func TestSharedClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	opts := clientOptions{addr: mr.Addr()}
+	locker := &DistrubutedLockerBootloader{clientOptions: opts}
+	concurrency := &ConcurrencyBootloader{clientOptions: opts}
+	if err := locker.Boot(logx.GetLogger("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := concurrency.Boot(logx.GetLogger("test")); err != nil {
+		t.Fatal(err)
+	}
+	// 连接同一个redis时共用一个客户端，最后一个组件Destroy时关闭
+	if locker.Client != concurrency.instance.client {
+		t.Fatal("expected a shared client")
+	}
+	if err := locker.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := concurrency.instance.client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("client closed while still in use: %v", err)
+	}
+	if err := concurrency.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := concurrency.instance.client.Ping(context.Background()).Err(); err == nil {
+		t.Fatal("expected client closed")
+	}
+}
@@ -25,20 +25,13 @@ func init() {
 // DistrubutedLockerBootloader
 type DistrubutedLockerBootloader struct {
 	DistrubutedLocker
-
-	addr     string
-	db       int
-	username string
-	password string
+	clientOptions
 }
 
 func (d *DistrubutedLockerBootloader) AddFlags(fs *flag.FlagSet) {
-	flag.StringVar(&d.addr, "addr", "127.0.0.1:6379", "redis addr")
-	flag.IntVar(&d.db, "db", 0, "redis db")
-	flag.StringVar(&d.username, "username", "", "redis username")
-	flag.StringVar(&d.password, "password", "", "redis password")
-	flag.DurationVar(&d.Expiration, "expiration", 10*time.Second, "expiration period")
-	flag.DurationVar(&d.Renewal, "renewal", 3*time.Second, "renewal interval")
+	d.clientOptions.AddFlags(fs)
+	fs.DurationVar(&d.Expiration, "expiration", 10*time.Second, "expiration period")
+	fs.DurationVar(&d.Renewal, "renewal", 3*time.Second, "renewal interval")
 }
 
 func (d *DistrubutedLockerBootloader) ValidateFlags() error {
@@ -49,12 +42,7 @@ func (d *DistrubutedLockerBootloader) Boot(log *logx.Logger) error {
 	d.LockValue = fmt.Sprintf("%s:%s", runtime.GetServiceName(), runtime.GetServiceID())
 	d.Logger = log
 	var err error
-	d.Client, err = redis.NewRedis(context.Background(), &redis.Options{
-		Addr:     d.addr,
-		DB:       d.db,
-		Username: d.username,
-		Password: d.password,
-	})
+	d.Client, err = d.acquireClient()
 	return err
 }
 
@@ -67,7 +55,7 @@ func (d *DistrubutedLockerBootloader) Instance() component.DistrubutedLocker {
 }
 
 func (d *DistrubutedLockerBootloader) Destroy() error {
-	return d.Client.Close()
+	return d.releaseClient()
 }
 
 type DistrubutedLocker struct {
@@ -2,16 +2,18 @@ package servicemesh
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	"log/slog"
-
 	"context"
 
-	"github.com/daemtri/begonia/di/box/validate"
+	"github.com/daemtri/begonia/logx"
 	"github.com/daemtri/begonia/runtime"
 	"github.com/daemtri/begonia/runtime/component"
 	"github.com/redis/go-redis/v9"
@@ -21,22 +23,63 @@ const (
 	Name = "servicemesh"
 )
 
+// registerScript KEYS=实例hash,过期时间zset,通知channel ARGV[1]=id ARGV[2]=ServiceEntry json ARGV[3]=过期时间毫秒
+// 实例不存在或内容变化时发布通知，续约时也使用该脚本，实例被清理后会自动重新注册
+var registerScript = redis.NewScript(`
+local old = redis.call("HGET", KEYS[1], ARGV[1])
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+local added = redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+if added == 1 or old ~= ARGV[2] then
+	redis.call("PUBLISH", KEYS[3], ARGV[1])
+end
+return added`)
+
+// deregisterScript KEYS=实例hash,过期时间zset,通知channel ARGV[1]=id
+var deregisterScript = redis.NewScript(`
+redis.call("HDEL", KEYS[1], ARGV[1])
+local n = redis.call("ZREM", KEYS[2], ARGV[1])
+if n > 0 then
+	redis.call("PUBLISH", KEYS[3], ARGV[1])
+end
+return n`)
+
+// browseScript KEYS=实例hash,过期时间zset,通知channel ARGV[1]=当前时间毫秒
+// 清理已过期的实例并返回 [最早过期时间, id1, entry1, id2, entry2...]
+var browseScript = redis.NewScript(`
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[1])
+if #expired > 0 then
+	redis.call("ZREM", KEYS[2], unpack(expired))
+	redis.call("HDEL", KEYS[1], unpack(expired))
+	redis.call("PUBLISH", KEYS[3], "expired")
+end
+local ret = {""}
+local first = redis.call("ZRANGE", KEYS[2], 0, 0, "WITHSCORES")
+if #first > 0 then
+	ret[1] = first[2]
+end
+local ids = redis.call("ZRANGE", KEYS[2], 0, -1)
+for _, id in ipairs(ids) do
+	local entry = redis.call("HGET", KEYS[1], id)
+	if entry then
+		table.insert(ret, id)
+		table.insert(ret, entry)
+	end
+end
+return ret`)
+
 func init() {
 	component.Register[component.Discovery](Name, &DiscoveryBootloader{})
 }
 
 type DiscoveryBootloader struct {
-	reg           Registry
+	reg           *Registry
 	redisAddr     string
 	redisUsername string
 	redisPassword string
 	redisDB       int
 	PodIP         string
-}
-
-func (d *DiscoveryBootloader) Destroy() error {
-	//TODO implement me
-	panic("implement me")
+	ttl           time.Duration
+	resync        time.Duration
 }
 
 func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
@@ -45,45 +88,86 @@ func (d *DiscoveryBootloader) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&d.redisPassword, "redis-password", "", "redis password")
 	fs.IntVar(&d.redisDB, "redis-db", 0, "redis db")
 	fs.StringVar(&d.PodIP, "pod_ip", "", "pod ip")
+	fs.DurationVar(&d.ttl, "ttl", 10*time.Second, "服务注册的过期时间,每ttl/3续约一次")
+	fs.DurationVar(&d.resync, "resync", 30*time.Second, "watch时全量同步的间隔,防止丢失通知")
 }
 
 func (d *DiscoveryBootloader) ValidateFlags() error {
-	return validate.Struct(d)
+	if d.ttl < time.Second {
+		return fmt.Errorf("servicemesh ttl must be at least 1s, got %s", d.ttl)
+	}
+	if d.resync <= 0 {
+		return fmt.Errorf("servicemesh resync must be positive, got %s", d.resync)
+	}
+	return nil
 }
 
-func (d *DiscoveryBootloader) Boot(logger *slog.Logger) error {
-	d.reg.logger = logger
-	d.reg.redisClient = redis.NewClient(&redis.Options{
+func (d *DiscoveryBootloader) Boot(logger *logx.Logger) error {
+	client := redis.NewClient(&redis.Options{
 		Addr:     d.redisAddr,
 		Username: d.redisUsername,
 		Password: d.redisPassword,
 		DB:       d.redisDB,
 	})
-	d.reg.podIP = d.PodIP
-	return d.reg.Boot()
+	d.reg = NewRegistry(client, d.ttl, d.resync, logger)
+	return nil
 }
 
 func (d *DiscoveryBootloader) Retrofit() error {
-	//TODO implement me
-	panic("implement me")
+	return nil
 }
 
 func (d *DiscoveryBootloader) Instance() component.Discovery {
-	return &d.reg
+	return d.reg
 }
 
+func (d *DiscoveryBootloader) Destroy() error {
+	return d.reg.Close()
+}
+
+// Registry 基于redis的服务注册发现
+// 有状态服务(cluster)的实例保存在hash wan:{ns}:apps:{name}:instances 中，值为ServiceEntry的json
+// 实例的过期时间保存在zset wan:{ns}:apps:{name}:expiry 中，注册后每ttl/3续约一次
+// 实例变化时向 wan:{ns}:apps:{name}:events 发布通知，watch收到通知或最早的实例过期时重新读取
+// 服务配置保存在hash wan:{ns}:apps:{name}:configs 中，会覆盖默认配置
+// 无状态服务(service)由服务网格负责负载均衡，直接访问 grpc://{name}:80
 type Registry struct {
-	logger      *slog.Logger
+	logger      *logx.Logger
 	redisClient *redis.Client
-	podIP       string
+	ttl         time.Duration
+	resync      time.Duration
+
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	mux           sync.Mutex
+	registrations map[string]context.CancelFunc
 }
 
-func (r *Registry) Boot() error {
-	return nil
+func NewRegistry(client *redis.Client, ttl, resync time.Duration, logger *logx.Logger) *Registry {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{
+		logger:        logger,
+		redisClient:   client,
+		ttl:           ttl,
+		resync:        resync,
+		ctx:           ctx,
+		cancel:        cancel,
+		registrations: make(map[string]context.CancelFunc),
+	}
 }
 
-func registerKey(name, id string) string {
-	return fmt.Sprintf("wan:%s:apps:%s:%s", runtime.GetNamespace(), name, id)
+func serviceKey(name, suffix string) string {
+	return fmt.Sprintf("wan:%s:apps:%s:%s", runtime.GetNamespace(), name, suffix)
+}
+
+func serviceKeys(name string) []string {
+	return []string{serviceKey(name, "instances"), serviceKey(name, "expiry"), serviceKey(name, "events")}
+}
+
+func (r *Registry) register(ctx context.Context, service component.ServiceEntry, se []byte) error {
+	expireAt := time.Now().Add(r.ttl).UnixMilli()
+	return registerScript.Run(ctx, r.redisClient, serviceKeys(service.Name), service.ID, se, expireAt).Err()
 }
 
 func (r *Registry) Register(ctx context.Context, service component.ServiceEntry) error {
@@ -92,38 +176,69 @@ func (r *Registry) Register(ctx context.Context, service component.ServiceEntry)
 	if err != nil {
 		return err
 	}
-	ret := r.redisClient.SetNX(ctx, registerKey(service.Name, service.ID), se, 10*time.Second)
-	if ret.Err() != nil {
-		return ret.Err()
+	if err := r.register(ctx, service, se); err != nil {
+		return err
+	}
+
+	key := serviceKey(service.Name, service.ID)
+	kctx, cancel := context.WithCancel(r.ctx)
+	r.mux.Lock()
+	if prev, ok := r.registrations[key]; ok {
+		prev()
 	}
+	r.registrations[key] = cancel
+	r.mux.Unlock()
+
+	r.wg.Add(1)
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		for {
-			select {
-			case <-ticker.C:
-				r.redisClient.Expire(ctx, registerKey(service.Name, service.ID), 10*time.Second)
-			case <-ctx.Done():
-				return
-			}
-		}
+		defer r.wg.Done()
+		r.keepalive(kctx, service, se)
 	}()
 	return nil
 }
 
+// keepalive 每ttl/3续约一次，直到注销或关闭
+func (r *Registry) keepalive(ctx context.Context, service component.ServiceEntry, se []byte) {
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.register(ctx, service, se); err != nil && ctx.Err() == nil {
+				r.logger.Warn("refresh service registration error", "service", service.Name, "id", service.ID, "error", err)
+			}
+		}
+	}
+}
+
+func (r *Registry) Deregister(ctx context.Context, service component.ServiceEntry) error {
+	r.logger.Info("deregister", "service", service)
+	key := serviceKey(service.Name, service.ID)
+	r.mux.Lock()
+	if cancel, ok := r.registrations[key]; ok {
+		cancel()
+		delete(r.registrations, key)
+	}
+	r.mux.Unlock()
+	return deregisterScript.Run(ctx, r.redisClient, serviceKeys(service.Name), service.ID).Err()
+}
+
 func (r *Registry) Lookup(ctx context.Context, name, id string) (se *component.ServiceEntry, err error) {
 	st := runtime.ParseServiceType(name)
 	switch st {
 	case runtime.ServiceTypeCluster:
-		ret := r.redisClient.Get(ctx, registerKey(name, id))
-		if ret.Err() != nil {
-			return nil, ret.Err()
-		}
-		se := component.ServiceEntry{}
-		err = json.Unmarshal([]byte(ret.Val()), &se)
+		s, _, err := r.browseCluster(ctx, name)
 		if err != nil {
 			return nil, err
 		}
-		return &se, nil
+		for i := range s.Entries {
+			if s.Entries[i].ID == id {
+				return &s.Entries[i], nil
+			}
+		}
+		return nil, fmt.Errorf("service %s/%s not found", name, id)
 	case runtime.ServiceTypeService:
 		return &component.ServiceEntry{
 			ID:   id,
@@ -141,72 +256,196 @@ func (r *Registry) Browse(ctx context.Context, name string) (*component.Service,
 	st := runtime.ParseServiceType(name)
 	switch st {
 	case runtime.ServiceTypeCluster:
-		ret := r.redisClient.Keys(ctx, registerKey(name, "*"))
-		if ret.Err() != nil {
-			return nil, ret.Err()
-		}
-		ids := ret.Val()
-		s := &component.Service{
-			Entries: make([]component.ServiceEntry, 0, len(ids)),
-		}
-		for _, id := range ids {
-			se := component.ServiceEntry{}
-			err := json.Unmarshal([]byte(id), &se)
-			if err != nil {
-				return nil, err
-			}
-			s.Entries = append(s.Entries, se)
-			s.Configs = []component.ConfigItem{
-				{
-					Key:   "LoadBalancingConfig",
-					Value: "specify",
-				},
-			}
-		}
-		return s, nil
+		s, _, err := r.browseCluster(ctx, name)
+		return s, err
 	default:
-		return &component.Service{
-			Entries: []component.ServiceEntry{
-				{
-					ID:   "unknown",
-					Name: name,
-					Endpoints: []string{
-						fmt.Sprintf("grpc://%s:80", name),
-					},
+		return meshService(name), nil
+	}
+}
+
+func meshService(name string) *component.Service {
+	return &component.Service{
+		Entries: []component.ServiceEntry{
+			{
+				ID:   "unknown",
+				Name: name,
+				Endpoints: []string{
+					fmt.Sprintf("grpc://%s:80", name),
 				},
 			},
-			Configs: []component.ConfigItem{
-				{
-					Key:   "LoadBalancingConfig",
-					Value: "pick_first",
-				},
+		},
+		Configs: []component.ConfigItem{
+			{
+				Key:   "LoadBalancingConfig",
+				Value: "pick_first",
 			},
-		}, nil
+		},
+	}
+}
+
+// browseCluster 读取未过期的实例，同时返回最早的过期时间，没有实例时为零值
+func (r *Registry) browseCluster(ctx context.Context, name string) (*component.Service, time.Time, error) {
+	ret, err := browseScript.Run(ctx, r.redisClient, serviceKeys(name), time.Now().UnixMilli()).StringSlice()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var nextExpiry time.Time
+	if ret[0] != "" {
+		var ms float64
+		if _, err := fmt.Sscan(ret[0], &ms); err == nil {
+			nextExpiry = time.UnixMilli(int64(ms))
+		}
+	}
+	s := &component.Service{Entries: make([]component.ServiceEntry, 0, (len(ret)-1)/2)}
+	for i := 1; i+1 < len(ret); i += 2 {
+		se := component.ServiceEntry{}
+		if err := json.Unmarshal([]byte(ret[i+1]), &se); err != nil {
+			r.logger.Warn("invalid service entry", "service", name, "id", ret[i], "error", err)
+			continue
+		}
+		s.Entries = append(s.Entries, se)
+	}
+	slices.SortFunc(s.Entries, func(a, b component.ServiceEntry) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	configs := map[string]string{"LoadBalancingConfig": "specify"}
+	custom, err := r.redisClient.HGetAll(ctx, serviceKey(name, "configs")).Result()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	for k, v := range custom {
+		configs[k] = v
 	}
+	for k, v := range configs {
+		s.Configs = append(s.Configs, component.ConfigItem{Key: k, Value: v})
+	}
+	slices.SortFunc(s.Configs, func(a, b component.ConfigItem) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return s, nextExpiry, nil
 }
 
 func (r *Registry) Watch(ctx context.Context, name string) component.Stream[*component.Service] {
-	var lastServcie *component.Service
-	return component.StreamFunc[*component.Service](func(stop bool) (*component.Service, error) {
-		if stop {
-			return nil, fmt.Errorf("stop watch")
+	ctx, cancel := context.WithCancel(ctx)
+	return &serviceWatcher{
+		Registry: r,
+		name:     name,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Close 停止所有续约，已注册的实例在过期后被清理
+func (r *Registry) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return r.redisClient.Close()
+}
+
+type serviceWatcher struct {
+	*Registry
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mux 保护pubsub和timer的创建，Stop可能和Next并发调用
+	mux    sync.Mutex
+	pubsub *redis.PubSub
+	events <-chan *redis.Message
+	timer  *time.Timer
+	last   *component.Service
+}
+
+// init 订阅服务的变更通知，Stop之后不再订阅
+func (w *serviceWatcher) init() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.pubsub != nil {
+		return nil
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	// 先订阅再读取，避免丢失读取期间的通知
+	pubsub := w.redisClient.Subscribe(w.ctx, serviceKey(w.name, "events"))
+	if _, err := pubsub.Receive(w.ctx); err != nil {
+		_ = pubsub.Close()
+		return fmt.Errorf("subscribe service %s events error: %w", w.name, err)
+	}
+	w.pubsub = pubsub
+	w.events = pubsub.Channel()
+	w.timer = time.NewTimer(w.resync)
+	return nil
+}
+
+// Next 第一次调用返回当前服务信息，之后在收到变更通知、实例过期或定期同步后有变化时返回
+func (w *serviceWatcher) Next() (*component.Service, error) {
+	if runtime.ParseServiceType(w.name) != runtime.ServiceTypeCluster {
+		if w.last != nil {
+			<-w.ctx.Done()
+			return nil, w.ctx.Err()
 		}
-		for {
-			if lastServcie != nil {
-				time.Sleep(1 * time.Second)
-			}
-			s, err := r.Browse(ctx, name)
-			if err != nil {
-				return nil, err
+		w.last = meshService(w.name)
+		return w.last, nil
+	}
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	for {
+		if w.last != nil {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case _, ok := <-w.events:
+				if !ok {
+					return nil, errors.New("servicemesh watcher closed")
+				}
+			case <-w.timer.C:
 			}
-			if lastServcie == nil {
-				lastServcie = s
-				return s, nil
+		}
+		s, nextExpiry, err := w.browseCluster(w.ctx, w.name)
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return nil, w.ctx.Err()
 			}
-			if !reflect.DeepEqual(lastServcie, s) {
-				lastServcie = s
-				return s, nil
+			w.logger.Warn("browse service error, retry later", "service", w.name, "error", err)
+			w.resetTimer(time.Second)
+			if w.last == nil {
+				return nil, err
 			}
+			continue
 		}
-	})
+		// 最早的实例过期时重新读取，清理过期实例
+		wait := w.resync
+		if !nextExpiry.IsZero() {
+			wait = min(wait, max(time.Until(nextExpiry)+10*time.Millisecond, 10*time.Millisecond))
+		}
+		w.resetTimer(wait)
+		if w.last != nil && reflect.DeepEqual(w.last, s) {
+			continue
+		}
+		w.last = s
+		return s, nil
+	}
+}
+
+func (w *serviceWatcher) resetTimer(d time.Duration) {
+	if !w.timer.Stop() {
+		select {
+		case <-w.timer.C:
+		default:
+		}
+	}
+	w.timer.Reset(d)
+}
+
+func (w *serviceWatcher) Stop() {
+	w.cancel()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.pubsub != nil {
+		_ = w.pubsub.Close()
+		w.timer.Stop()
+	}
 }
@@ -0,0 +1,133 @@
+package servicemesh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daemtri/begonia/logx"
+	"github.com/daemtri/begonia/runtime/component"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRegistry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := NewRegistry(client, time.Second, time.Minute, logx.GetLogger("test"))
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// app101 为有状态服务
+	stream := r.Watch(ctx, "app101")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 || len(s.Configs) != 1 || s.Configs[0].Value != "specify" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+
+	entry := component.ServiceEntry{ID: "1", Name: "app101", Endpoints: []string{"grpc://127.0.0.1:8090"}}
+	if err := r.Register(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 || s.Entries[0].ID != "1" || s.Entries[0].Endpoints[0] != "grpc://127.0.0.1:8090" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+
+	if err := r.Deregister(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	// 注销后不再续约
+	time.Sleep(500 * time.Millisecond)
+	if n, _ := mr.HKeys(serviceKey("app101", "instances")); len(n) != 0 {
+		t.Fatalf("instance registered again after deregister: %v", n)
+	}
+}
+
+func TestRegistryExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := NewRegistry(client, time.Second, time.Minute, logx.GetLogger("test"))
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 模拟其他进程注册后崩溃，未续约的实例在过期后被清理
+	entry := component.ServiceEntry{ID: "2", Name: "app101"}
+	if err := r.register(ctx, entry, []byte(`{"id":"2","name":"app101"}`)); err != nil {
+		t.Fatal(err)
+	}
+	stream := r.Watch(ctx, "app101")
+	defer stream.Stop()
+	s, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+	s, err = stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 0 {
+		t.Fatalf("unexpected service %+v", s)
+	}
+}
+
+func TestRegistryMeshService(t *testing.T) {
+	r := NewRegistry(redis.NewClient(&redis.Options{}), time.Second, time.Minute, logx.GetLogger("test"))
+	s, err := r.Browse(context.Background(), "app001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 1 || s.Entries[0].Endpoints[0] != "grpc://app001:80" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+}
+
+func TestRegistryStopWatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := NewRegistry(client, time.Second, time.Minute, logx.GetLogger("test"))
+	defer r.Close()
+
+	// Stop和Next并发调用时不会泄漏订阅
+	for i := 0; i < 10; i++ {
+		stream := r.Watch(context.Background(), "app101")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, err := stream.Next(); err != nil {
+					return
+				}
+			}
+		}()
+		stream.Stop()
+		<-done
+	}
+	channel := serviceKey("app101", "events")
+	deadline := time.Now().Add(time.Second)
+	for mr.PubSubNumSub(channel)[channel] != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription leaked: %v", mr.PubSubNumSub(channel))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}